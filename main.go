@@ -1,20 +1,30 @@
 package main
 
 import (
+	"context"
+	_ "embed"
 	"fmt"
 	"log/slog"
 	"os"
-	"os/exec"
-	"strings"
-
+	"path/filepath"
+	"slices"
+
+	"github.com/bethel-nz/trace/pkg/agent"
+	"github.com/bethel-nz/trace/pkg/checkpoint"
+	"github.com/bethel-nz/trace/pkg/config"
+	"github.com/bethel-nz/trace/pkg/mcp"
+	"github.com/bethel-nz/trace/pkg/provider"
 	"github.com/bethel-nz/trace/pkg/ui"
+	"github.com/bethel-nz/trace/pkg/worktree"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/joho/godotenv"
-	"github.com/sashabaranov/go-openai"
 )
 
+//go:embed system_prompt.md
+var defaultSystemPrompt string
+
 // --- Main ---
 
 func main() {
@@ -35,6 +45,40 @@ func main() {
 
 	slog.Info("Trace starting up")
 
+	// Load config and set up the tool registry before the prompt documents it
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	// `trace mcp serve` publishes the tools over stdio instead of starting the TUI
+	if len(os.Args) > 1 && os.Args[1] == "mcp" {
+		if err := runMCP(os.Args[2:], cfg); err != nil {
+			slog.Error("MCP server failed", "error", err)
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// --worktree runs the session in a fresh git worktree so the user's checkout is untouched.
+	// Everything after this is rooted there: tools, commands, file listings and checkpoints.
+	var tree *worktree.Worktree
+	if slices.Contains(os.Args[1:], "--worktree") {
+		if tree, err = worktree.Create("."); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if err := os.Chdir(tree.Dir()); err != nil {
+			exitWithError(tree, err)
+		}
+		// File tools may not leave the worktree, e.g. through ../ into the user's checkout
+		agent.Root = tree.Path
+		agent.TrashDir = filepath.Join(tree.Origin, agent.TrashDir)
+		slog.Info("Running in worktree", "path", tree.Path, "branch", tree.Branch)
+	}
+
 	apiKey := os.Getenv("PROVIDER_API_KEY")
 	authToken := os.Getenv("PROVIDER_AUTH_TOKEN")
 	if apiKey == "" && authToken != "" {
@@ -43,52 +87,115 @@ func main() {
 
 	slog.Debug("Config loaded", "baseURL", os.Getenv("PROVIDER_BASE_URL"), "model", os.Getenv("PROVIDER_MODEL"))
 
-	config := openai.DefaultConfig(apiKey)
-	if baseURL := os.Getenv("PROVIDER_BASE_URL"); baseURL != "" {
-		config.BaseURL = baseURL
-	}
+	// The provider client records Retry-After headers for the retry layer
+	client := provider.NewClient(apiKey, os.Getenv("PROVIDER_BASE_URL"))
 
-	client := openai.NewClientWithConfig(config)
+	mcpServers, err := setupTools(cfg, true)
+	if err != nil {
+		exitWithError(tree, err)
+	}
+	defer mcpServers.Close()
 
 	// PREVENT TERMINAL ARTIFACTS: formatting queries
 	lipgloss.SetHasDarkBackground(true)
 
 	// Initialize the File List (Respecting gitignore)
-	files, _ := listProjectFiles()
+	files, _ := agent.ListProjectFiles()
 
-	// Load System Prompt
-	var sysPrompt string
+	// Load System Prompt (a local system_prompt.md overrides the built-in template)
+	promptTemplate := defaultSystemPrompt
 	if promptBytes, err := os.ReadFile("system_prompt.md"); err == nil {
-		sysPrompt = string(promptBytes)
-	} else {
+		promptTemplate = string(promptBytes)
+	}
+	sysPrompt, err := agent.RenderSystemPrompt(promptTemplate, agent.GetAllToolDefinitions())
+	if err != nil {
+		slog.Error("Failed to render system prompt", "error", err)
 		sysPrompt = "You are Trace, a helpful AI coding assistant."
 	}
 
+	model := ui.InitialModel(client, cfg, files, sysPrompt)
+	model.Prompts = ui.LoadPromptHistory(ui.DefaultPromptHistoryPath())
+	model.Session.Path = ui.DefaultSessionPath()
+
+	// Snapshot the working tree at the start of each turn for /rewind
+	model.Snapshots = checkpoint.NewStore(".")
+	agent.BeforeWrite = model.Snapshots.Track
+
+	// Sessions are saved in the user's checkout, where they outlive the worktree
+	if tree != nil {
+		model.Worktree = tree
+		model.Session.Path = filepath.Join(tree.Origin, model.Session.Path)
+	}
+
 	// DISABLE MOUSE temporarily to fix artifacts reported by user
-	p := tea.NewProgram(ui.InitialModel(client, files, sysPrompt), tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
-		fmt.Println("Error:", err)
-		os.Exit(1)
+	p := tea.NewProgram(model, tea.WithAltScreen())
+	final, err := p.Run()
+	if err != nil {
+		mcpServers.Close()
+		exitWithError(tree, err)
+	}
+	if msg := final.(ui.Model).ExitMessage; msg != "" {
+		fmt.Println(msg)
 	}
 }
 
-// --- File System ---
-
-func listProjectFiles() ([]string, error) {
-	cmd := exec.Command("git", "ls-files", "-c", "-o", "--exclude-standard")
-	out, err := cmd.Output()
-	if err != nil {
-		// Fallback for non-git
-		return []string{}, err
+// exitWithError reports err and exits. A session worktree is removed with its branch
+// unless it already holds changes, which are kept for the user.
+func exitWithError(tree *worktree.Worktree, err error) {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	if tree != nil {
+		os.Chdir(tree.Origin)
+		if changes, changesErr := tree.Changes(); changesErr == nil && changes == "" {
+			if err := tree.Discard(); err != nil {
+				slog.Error("Removing the worktree failed", "error", err)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "The worktree is kept at %s on branch %s.\n", tree.Path, tree.Branch)
+		}
 	}
+	os.Exit(1)
+}
 
-	lines := strings.Split(string(out), "\n")
-	var clean []string
-	for _, l := range lines {
-		l = strings.TrimSpace(l)
-		if l != "" && !strings.HasPrefix(l, ".git") && l != "agent" && l != "trace" && !strings.HasPrefix(l, "bin/") && l != ".env" {
-			clean = append(clean, l)
+// setupTools registers plugins (and optionally MCP server tools) declared in config,
+// then applies the enabled/disabled lists
+func setupTools(cfg config.Config, startMCP bool) (*mcp.Manager, error) {
+	for _, plugin := range cfg.Tools.Plugins {
+		def, err := agent.NewPluginTool(plugin)
+		if err != nil {
+			return nil, err
 		}
+		agent.Register(def)
+		slog.Info("Registered plugin tool", "name", plugin.Name, "command", plugin.Command)
+	}
+
+	if err := agent.ConfigureHooks(cfg.Hooks.PostEdit); err != nil {
+		return nil, err
 	}
-	return clean, nil
+
+	servers := &mcp.Manager{}
+	if startMCP {
+		servers = mcp.StartServers(context.Background(), cfg.MCPServers, agent.DefaultRegistry)
+	}
+	if err := agent.DefaultRegistry.Configure(cfg.Tools.Enabled, cfg.Tools.Disabled); err != nil {
+		servers.Close()
+		return nil, err
+	}
+	return servers, nil
+}
+
+// runMCP handles the `trace mcp <command>` subcommands
+func runMCP(args []string, cfg config.Config) error {
+	if len(args) == 0 || args[0] != "serve" {
+		return fmt.Errorf("usage: trace mcp serve")
+	}
+
+	// Upstream MCP servers are not proxied, so `trace mcp serve` can't loop back into itself
+	servers, err := setupTools(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer servers.Close()
+
+	slog.Info("Serving tools over MCP stdio")
+	return mcp.NewServer(agent.DefaultRegistry).Serve(context.Background(), os.Stdin, os.Stdout)
 }
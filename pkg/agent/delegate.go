@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Sub-agent tool modes
+const (
+	DelegateModeExplore = "explore" // Read-only tools
+	DelegateModeFull    = "full"    // Every headless tool except delegation itself
+)
+
+// DefaultDelegateIterations is the sub-agent's iteration budget when none is given
+const DefaultDelegateIterations = 15
+
+// --- Delegate Task ---
+
+type DelegateTaskInput struct {
+	Task          string `json:"task" jsonschema_description:"A complete, self-contained description of the task. The sub-agent cannot see this conversation."`
+	Mode          string `json:"mode,omitempty" jsonschema:"enum=explore,enum=full" jsonschema_description:"'explore' (default) gives the sub-agent read-only tools; 'full' also allows editing files and running commands."`
+	MaxIterations int    `json:"max_iterations,omitempty" jsonschema_description:"Maximum number of model calls the sub-agent may make. Defaults to 15."`
+}
+
+var DelegateTaskDefinition = ToolDefinition{
+	Name:        "delegate_task",
+	Description: "Delegate a self-contained task (e.g. exploring a large codebase) to a sub-agent with its own history and iteration budget. Only the sub-agent's final summary is returned.",
+	Parameters:  GenerateSchema[DelegateTaskInput](),
+	Function:    DelegateTask,
+	UIOnly:      true,
+}
+
+// DelegateTask only validates input; the TUI owns the model client and runs the sub-agent itself
+func DelegateTask(input json.RawMessage) (ToolResult, error) {
+	args, err := ParseDelegateTask(input)
+	if err != nil {
+		return ToolResult{}, err
+	}
+	return ToolResult{}, fmt.Errorf("delegate_task (%s) must be run by the Trace TUI", args.Mode)
+}
+
+// ParseDelegateTask decodes and validates delegate_task arguments, filling in defaults
+func ParseDelegateTask(input json.RawMessage) (DelegateTaskInput, error) {
+	var args DelegateTaskInput
+	if err := json.Unmarshal(input, &args); err != nil {
+		return args, err
+	}
+	if args.Task == "" {
+		return args, fmt.Errorf("task is required")
+	}
+	switch args.Mode {
+	case "":
+		args.Mode = DelegateModeExplore
+	case DelegateModeExplore, DelegateModeFull:
+	default:
+		return args, fmt.Errorf("invalid mode: %s", args.Mode)
+	}
+	if args.MaxIterations <= 0 {
+		args.MaxIterations = DefaultDelegateIterations
+	}
+	return args, nil
+}
+
+// SubagentTools returns the tools a sub-agent may use in the given mode.
+// UI-only tools are never included, which also rules out recursive delegation.
+func SubagentTools(mode string) []ToolDefinition {
+	var defs []ToolDefinition
+	for _, def := range GetAllToolDefinitions() {
+		if def.UIOnly {
+			continue
+		}
+		if mode != DelegateModeFull && !def.ReadOnly {
+			continue
+		}
+		defs = append(defs, def)
+	}
+	return defs
+}
@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSubagentTools(t *testing.T) {
+	// Explore mode only gets read-only tools
+	for _, def := range SubagentTools(DelegateModeExplore) {
+		if !def.ReadOnly || def.UIOnly {
+			t.Errorf("Tool %s should not be available in explore mode", def.Name)
+		}
+	}
+
+	// Full mode can write, but never delegates again or touches the UI
+	names := map[string]bool{}
+	for _, def := range SubagentTools(DelegateModeFull) {
+		names[def.Name] = true
+	}
+	if !names["edit_file"] || names["delegate_task"] || names["manage_window"] {
+		t.Errorf("Unexpected full-mode tools: %v", names)
+	}
+}
+
+func TestParseDelegateTask(t *testing.T) {
+	args, err := ParseDelegateTask(json.RawMessage(`{"task":"find the config loader"}`))
+	if err != nil {
+		t.Fatalf("ParseDelegateTask failed: %v", err)
+	}
+	if args.Mode != DelegateModeExplore || args.MaxIterations != DefaultDelegateIterations {
+		t.Errorf("Expected defaults, got %+v", args)
+	}
+
+	if _, err := ParseDelegateTask(json.RawMessage(`{"task":"x","mode":"yolo"}`)); err == nil {
+		t.Error("Expected error for invalid mode, got nil")
+	}
+}
@@ -0,0 +1,331 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bethel-nz/trace/pkg/config"
+)
+
+// --- Path Validation ---
+
+// Root confines the file tools: every path they change must resolve, symlinks included,
+// to somewhere inside it. --worktree sets it to the worktree; empty means the working directory.
+var Root string
+
+// checkPath refuses paths that tools must never change: anything outside Root, .env
+// files, git's own directory and Trace's state directory
+func checkPath(path string) error {
+	if err := checkName(path); err != nil {
+		return err
+	}
+	return checkRoot(path)
+}
+
+// checkName applies checkPath's rules on the path's own name: .env, .git and .trace
+func checkName(path string) error {
+	if strings.TrimSpace(path) == "" {
+		return fmt.Errorf("path is required")
+	}
+	if strings.HasSuffix(path, ".env") {
+		return fmt.Errorf("access denied: .env files are protected")
+	}
+	for _, part := range strings.Split(filepath.ToSlash(filepath.Clean(path)), "/") {
+		switch part {
+		case ".git":
+			return fmt.Errorf("access denied: %s is inside .git", path)
+		case config.ProjectDir:
+			return fmt.Errorf("access denied: %s is inside %s", path, config.ProjectDir)
+		}
+	}
+	return nil
+}
+
+// checkRoot refuses paths that lead outside Root, through ../, an absolute path or a symlink
+func checkRoot(path string) error {
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(resolveExisting(root), resolveExisting(abs))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("access denied: %s is outside the project", path)
+	}
+	return nil
+}
+
+// projectRoot returns Root, or the working directory when it is not set
+func projectRoot() (string, error) {
+	if Root != "" {
+		return filepath.Abs(Root)
+	}
+	return os.Getwd()
+}
+
+// resolveExisting evaluates the symlinks in the longest existing part of path, so a
+// file that doesn't exist yet resolves to where it would be created
+func resolveExisting(path string) string {
+	var missing []string
+	for {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(append([]string{path}, missing...)...)
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// checkTree applies checkPath to path and checkName to everything in it, so a
+// directory holding a .env file can't be moved or deleted wholesale
+func checkTree(path string) error {
+	if err := checkPath(path); err != nil {
+		return err
+	}
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return checkName(p)
+	})
+}
+
+// beforeWriteTree calls beforeWrite for path, or every file under it
+func beforeWriteTree(path string) {
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			beforeWrite(p)
+		}
+		return nil
+	})
+}
+
+// --- Move File ---
+
+type MoveFileInput struct {
+	Source      string `json:"source" jsonschema_description:"The relative path of the file or directory to move."`
+	Destination string `json:"destination" jsonschema_description:"The new relative path. Parent directories are created; an existing file is never overwritten."`
+}
+
+var MoveFileDefinition = ToolDefinition{
+	Name:        "move_file",
+	Description: "Move or rename a file or directory.",
+	Parameters:  GenerateSchema[MoveFileInput](),
+	Function:    MoveFile,
+}
+
+func MoveFile(input json.RawMessage) (ToolResult, error) {
+	var args MoveFileInput
+	if err := json.Unmarshal(input, &args); err != nil {
+		return ToolResult{}, err
+	}
+	if err := checkTree(args.Source); err != nil {
+		return ToolResult{}, err
+	}
+	if err := checkPath(args.Destination); err != nil {
+		return ToolResult{}, err
+	}
+	if _, err := os.Lstat(args.Destination); err == nil {
+		return ToolResult{}, fmt.Errorf("%s already exists", args.Destination)
+	}
+	if err := os.MkdirAll(filepath.Dir(args.Destination), 0755); err != nil {
+		return ToolResult{}, fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	// Checkpoints need both ends: the source to restore, the destination to remove
+	beforeWriteTree(args.Source)
+	filepath.WalkDir(args.Source, func(p string, d fs.DirEntry, err error) error {
+		if rel, relErr := filepath.Rel(args.Source, p); err == nil && relErr == nil && !d.IsDir() {
+			beforeWrite(filepath.Join(args.Destination, rel))
+		}
+		return nil
+	})
+	if err := os.Rename(args.Source, args.Destination); err != nil {
+		return ToolResult{}, fmt.Errorf("failed to move: %v", err)
+	}
+	forgetVersion(args.Source)
+
+	return ToolResult{
+		Content:  fmt.Sprintf("Moved %s to %s", args.Source, args.Destination),
+		Metadata: map[string]any{"path": args.Destination, "source": args.Source},
+	}, nil
+}
+
+// --- Delete File ---
+
+// TrashDir is where deleted files go, under their path in the project: .trace/trash/<session start>/.
+// A session in a worktree roots it in the user's checkout, so the trash outlives the worktree.
+var TrashDir = filepath.Join(config.ProjectDir, "trash", time.Now().Format("20060102-150405"))
+
+type DeleteFileInput struct {
+	Path string `json:"path" jsonschema_description:"The relative path of the file or directory to delete."`
+}
+
+var DeleteFileDefinition = ToolDefinition{
+	Name:        "delete_file",
+	Description: "Delete a file or directory. It is moved to the session trash (.trace/trash) so the user can recover it.",
+	Parameters:  GenerateSchema[DeleteFileInput](),
+	Function:    DeleteFile,
+}
+
+func DeleteFile(input json.RawMessage) (ToolResult, error) {
+	var args DeleteFileInput
+	if err := json.Unmarshal(input, &args); err != nil {
+		return ToolResult{}, err
+	}
+	if err := checkTree(args.Path); err != nil {
+		return ToolResult{}, err
+	}
+	abs, err := filepath.Abs(args.Path)
+	if err != nil {
+		return ToolResult{}, err
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return ToolResult{}, err
+	}
+
+	// Keep the file's place in the project, numbering repeat deletions of the same path
+	rel, err := filepath.Rel(root, abs)
+	switch {
+	case err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)):
+		return ToolResult{}, fmt.Errorf("access denied: %s is outside the project", args.Path)
+	case rel == ".":
+		return ToolResult{}, fmt.Errorf("refusing to delete the project directory")
+	}
+	trash := filepath.Join(TrashDir, rel)
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(trash); os.IsNotExist(err) {
+			break
+		}
+		trash = fmt.Sprintf("%s.%d", filepath.Join(TrashDir, rel), n)
+	}
+	if err := os.MkdirAll(filepath.Dir(trash), 0755); err != nil {
+		return ToolResult{}, fmt.Errorf("failed to create trash directory: %v", err)
+	}
+
+	beforeWriteTree(args.Path)
+	if err := os.Rename(args.Path, trash); err != nil {
+		return ToolResult{}, fmt.Errorf("failed to move to trash: %v", err)
+	}
+	forgetVersion(args.Path)
+
+	return ToolResult{
+		Content:  fmt.Sprintf("Deleted %s (moved to %s)", args.Path, trash),
+		Metadata: map[string]any{"path": args.Path, "trash": trash},
+	}, nil
+}
+
+// --- Make Dir ---
+
+type MakeDirInput struct {
+	Path string `json:"path" jsonschema_description:"The relative path of the directory to create, including any missing parents."`
+}
+
+var MakeDirDefinition = ToolDefinition{
+	Name:        "make_dir",
+	Description: "Create a directory and any missing parent directories.",
+	Parameters:  GenerateSchema[MakeDirInput](),
+	Function:    MakeDir,
+}
+
+func MakeDir(input json.RawMessage) (ToolResult, error) {
+	var args MakeDirInput
+	if err := json.Unmarshal(input, &args); err != nil {
+		return ToolResult{}, err
+	}
+	if err := checkPath(args.Path); err != nil {
+		return ToolResult{}, err
+	}
+	if info, err := os.Stat(args.Path); err == nil {
+		if !info.IsDir() {
+			return ToolResult{}, fmt.Errorf("%s exists and is not a directory", args.Path)
+		}
+		return ToolResult{Content: fmt.Sprintf("Directory %s already exists", args.Path)}, nil
+	}
+	if err := os.MkdirAll(args.Path, 0755); err != nil {
+		return ToolResult{}, fmt.Errorf("failed to create directory: %v", err)
+	}
+	return ToolResult{
+		Content:  fmt.Sprintf("Created directory %s", args.Path),
+		Metadata: map[string]any{"path": args.Path},
+	}, nil
+}
+
+// --- File Info ---
+
+type FileInfoInput struct {
+	Path string `json:"path" jsonschema_description:"The relative path of the file or directory."`
+}
+
+var FileInfoDefinition = ToolDefinition{
+	Name:        "file_info",
+	Description: "Show whether a path exists and its type, size, permissions and modification time, plus the line count of text files or the entry count of directories.",
+	Parameters:  GenerateSchema[FileInfoInput](),
+	Function:    FileInfo,
+	ReadOnly:    true,
+}
+
+func FileInfo(input json.RawMessage) (ToolResult, error) {
+	var args FileInfoInput
+	if err := json.Unmarshal(input, &args); err != nil {
+		return ToolResult{}, err
+	}
+	if err := checkPath(args.Path); err != nil {
+		return ToolResult{}, err
+	}
+	info, err := os.Lstat(args.Path)
+	if os.IsNotExist(err) {
+		return ToolResult{Content: fmt.Sprintf("%s does not exist", args.Path), Metadata: map[string]any{"path": args.Path, "exists": false}}, nil
+	}
+	if err != nil {
+		return ToolResult{}, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Path: %s\n", args.Path)
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, _ := os.Readlink(args.Path)
+		fmt.Fprintf(&b, "Type: symlink to %s\n", target)
+	case info.IsDir():
+		entries, _ := os.ReadDir(args.Path)
+		fmt.Fprintf(&b, "Type: directory\nEntries: %d\n", len(entries))
+	default:
+		fmt.Fprintf(&b, "Type: file\nSize: %d bytes\n", info.Size())
+		// Same limits as read_file
+		if info.Size() <= maxReadSize {
+			if content, err := os.ReadFile(args.Path); err == nil {
+				if utf8.Valid(content) {
+					// A final newline ends the last line rather than starting another
+					lines := strings.Count(string(content), "\n")
+					if len(content) > 0 && content[len(content)-1] != '\n' {
+						lines++
+					}
+					fmt.Fprintf(&b, "Lines: %d\n", lines)
+				} else {
+					b.WriteString("Binary: yes\n")
+				}
+			}
+		}
+	}
+	fmt.Fprintf(&b, "Mode: %s\nModified: %s", info.Mode(), info.ModTime().Format(time.RFC3339))
+
+	return ToolResult{
+		Content:  b.String(),
+		Metadata: map[string]any{"path": args.Path, "exists": true, "bytes": info.Size(), "dir": info.IsDir()},
+	}, nil
+}
@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func callTool(t *testing.T, fn func(json.RawMessage) (ToolResult, error), args any) (ToolResult, error) {
+	t.Helper()
+	input, _ := json.Marshal(args)
+	return fn(input)
+}
+
+func TestMoveAndDeleteFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("a.txt", []byte("a"), 0644)
+
+	if _, err := callTool(t, MoveFile, MoveFileInput{Source: "a.txt", Destination: "sub/b.txt"}); err != nil {
+		t.Fatalf("MoveFile failed: %v", err)
+	}
+	expectContent(t, "sub/b.txt", "a")
+	os.WriteFile("a.txt", []byte("again"), 0644)
+	if _, err := callTool(t, MoveFile, MoveFileInput{Source: "a.txt", Destination: "sub/b.txt"}); err == nil {
+		t.Error("Expected moving onto an existing file to fail")
+	}
+
+	// Deleting the same path twice keeps both copies in the trash
+	var trashed []string
+	for range 2 {
+		os.WriteFile("sub/b.txt", []byte("b"), 0644)
+		result, err := callTool(t, DeleteFile, DeleteFileInput{Path: "sub/b.txt"})
+		if err != nil {
+			t.Fatalf("DeleteFile failed: %v", err)
+		}
+		trashed = append(trashed, result.Metadata["trash"].(string))
+	}
+	if _, err := os.Stat("sub/b.txt"); !os.IsNotExist(err) {
+		t.Error("Expected sub/b.txt to be deleted")
+	}
+	if trashed[0] != filepath.Join(TrashDir, "sub", "b.txt") || trashed[1] != trashed[0]+".1" {
+		t.Errorf("Expected numbered copies in the trash, got %v", trashed)
+	}
+	expectContent(t, trashed[1], "b")
+
+	// A directory holding a .env file can't be moved or deleted
+	os.MkdirAll("conf", 0755)
+	os.WriteFile("conf/.env", []byte("SECRET=1"), 0644)
+	if _, err := callTool(t, DeleteFile, DeleteFileInput{Path: "conf"}); err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Errorf("Expected deleting a directory with .env to be denied, got %v", err)
+	}
+	if _, err := callTool(t, MoveFile, MoveFileInput{Source: "conf", Destination: "other"}); err == nil {
+		t.Error("Expected moving a directory with .env to be denied")
+	}
+	if _, err := callTool(t, DeleteFile, DeleteFileInput{Path: "."}); err == nil {
+		t.Error("Expected deleting the working directory to fail")
+	}
+}
+
+func TestMoveAndDeleteOutsideProject(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "x"), []byte("x"), 0644)
+	os.Mkdir(filepath.Join(dir, "project"), 0755)
+	t.Chdir(filepath.Join(dir, "project"))
+
+	for _, path := range []string{"../x", filepath.Join(dir, "x"), "."} {
+		if _, err := callTool(t, DeleteFile, DeleteFileInput{Path: path}); err == nil {
+			t.Errorf("Expected deleting %q to be refused", path)
+		}
+	}
+	if _, err := callTool(t, MoveFile, MoveFileInput{Source: "../x", Destination: "x"}); err == nil {
+		t.Error("Expected moving a file from outside the project to be refused")
+	}
+	expectContent(t, filepath.Join(dir, "x"), "x")
+}
+
+func TestCheckPath(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, path := range []string{"", ".env", "config/prod.env", ".git/config", "a/../.git/HEAD", ".trace/trash/x"} {
+		if _, err := callTool(t, WriteFile, WriteFileInput{Path: path, Content: "x"}); err == nil {
+			t.Errorf("Expected writing %q to be refused", path)
+		}
+	}
+	if _, err := callTool(t, MakeDir, MakeDirInput{Path: ".git/hooks"}); err == nil {
+		t.Error("Expected make_dir in .git to be refused")
+	}
+}
+
+func TestRootConfinesTools(t *testing.T) {
+	checkout := t.TempDir()
+	tree := filepath.Join(checkout, ".git", "trace-worktrees", "s")
+	os.MkdirAll(tree, 0755)
+	os.Symlink(checkout, filepath.Join(tree, "out"))
+	t.Chdir(tree)
+	Root = tree
+	t.Cleanup(func() { Root = "" })
+
+	outside := filepath.Join(checkout, "x.txt")
+	for _, path := range []string{"../../../x.txt", outside, "out/x.txt"} {
+		if _, err := callTool(t, WriteFile, WriteFileInput{Path: path, Content: "x"}); err == nil || !strings.Contains(err.Error(), "outside the project") {
+			t.Errorf("Expected writing %q to be refused, got %v", path, err)
+		}
+	}
+	patch := "--- /dev/null\n+++ b/../../../x.txt\n@@ -0,0 +1 @@\n+x\n"
+	if _, err := applyPatch(t, patch); err == nil {
+		t.Error("Expected a patch creating a file outside the root to be refused")
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Fatalf("Expected nothing written to the checkout, got %v", err)
+	}
+
+	if _, err := callTool(t, WriteFile, WriteFileInput{Path: "sub/in.txt", Content: "x"}); err != nil {
+		t.Errorf("Expected writing inside the root to work, got %v", err)
+	}
+}
+
+func TestMakeDirAndFileInfo(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if _, err := callTool(t, MakeDir, MakeDirInput{Path: "a/b/c"}); err != nil {
+		t.Fatalf("MakeDir failed: %v", err)
+	}
+	os.WriteFile("a/file.txt", []byte("one\ntwo\n"), 0600)
+	if _, err := callTool(t, MakeDir, MakeDirInput{Path: "a/file.txt"}); err == nil {
+		t.Error("Expected make_dir over a file to fail")
+	}
+
+	result, err := callTool(t, FileInfo, FileInfoInput{Path: "a/file.txt"})
+	if err != nil {
+		t.Fatalf("FileInfo failed: %v", err)
+	}
+	for _, want := range []string{"Type: file", "Size: 8 bytes", "Lines: 2", "Mode: -rw-------"} {
+		if !strings.Contains(result.Content, want) {
+			t.Errorf("Expected %q in:\n%s", want, result.Content)
+		}
+	}
+	os.WriteFile("a/partial.txt", []byte("one\ntwo"), 0644)
+	if result, _ := callTool(t, FileInfo, FileInfoInput{Path: "a/partial.txt"}); !strings.Contains(result.Content, "Lines: 2") {
+		t.Errorf("Expected 2 lines without a final newline, got:\n%s", result.Content)
+	}
+	if result, _ := callTool(t, FileInfo, FileInfoInput{Path: "a"}); !strings.Contains(result.Content, "Entries: 3") {
+		t.Errorf("Expected a directory with 3 entries, got:\n%s", result.Content)
+	}
+	if result, err := callTool(t, FileInfo, FileInfoInput{Path: "missing"}); err != nil || result.Metadata["exists"] != false {
+		t.Errorf("Expected a missing path to be reported, got %+v (%v)", result, err)
+	}
+}
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bethel-nz/trace/pkg/config"
+)
+
+// --- Post-Edit Hooks ---
+
+// PostEditHooks run after write_file, edit_file and apply_patch change a matching file,
+// e.g. formatters and linters. Their output is added to the tool result for the model.
+var PostEditHooks []config.Hook
+
+// ConfigureHooks validates the post-edit hooks from config and installs them
+func ConfigureHooks(hooks []config.Hook) error {
+	for _, hook := range hooks {
+		if hook.Glob == "" || hook.Command == "" {
+			return fmt.Errorf("post_edit hook needs a glob and a command")
+		}
+		if _, err := filepath.Match(hook.Glob, ""); err != nil {
+			return fmt.Errorf("post_edit hook has an invalid glob %q: %w", hook.Glob, err)
+		}
+	}
+	PostEditHooks = hooks
+	return nil
+}
+
+// hookMatches reports whether a hook's glob matches path
+func hookMatches(glob, path string) bool {
+	path = filepath.ToSlash(filepath.Clean(path))
+	if !strings.Contains(glob, "/") {
+		path = filepath.Base(path)
+	}
+	ok, _ := filepath.Match(glob, path)
+	return ok
+}
+
+// hookArgs fills {file} and {dir} in the hook's arguments, or appends the file
+func hookArgs(hook config.Hook, path string) []string {
+	args := make([]string, len(hook.Args))
+	replaced := false
+	for i, arg := range hook.Args {
+		args[i] = strings.NewReplacer("{file}", path, "{dir}", filepath.Dir(path)).Replace(arg)
+		replaced = replaced || args[i] != arg
+	}
+	if !replaced {
+		args = append(args, path)
+	}
+	return args
+}
+
+// runPostEditHooks runs the hooks matching each changed file and returns their
+// diagnostics for the tool result, empty when no hook matched. Identical commands
+// (e.g. a vet of the same directory) run once. Files the hooks rewrite keep the version
+// the agent wrote in seenFiles, so the model has to read the new contents before editing again.
+func runPostEditHooks(paths []string) string {
+	var report []string
+	var ran [][]string
+	for _, path := range paths {
+		before, err := os.ReadFile(path)
+		if err != nil {
+			continue // Deleted
+		}
+		for _, hook := range PostEditHooks {
+			if !hookMatches(hook.Glob, path) {
+				continue
+			}
+			argv := append([]string{hook.Command}, hookArgs(hook, path)...)
+			if slices.ContainsFunc(ran, func(prev []string) bool { return slices.Equal(prev, argv) }) {
+				continue
+			}
+			ran = append(ran, argv)
+			if output := runHook(hook, argv); output != "" {
+				report = append(report, output)
+			}
+		}
+		if after, err := os.ReadFile(path); err == nil && string(after) != string(before) {
+			report = append(report, fmt.Sprintf("%s was rewritten by the hooks; read it again before editing it further.", path))
+		}
+	}
+	if len(ran) == 0 {
+		return ""
+	}
+	if len(report) == 0 {
+		return fmt.Sprintf("Post-edit hooks: %d passed.", len(ran))
+	}
+	return "Post-edit hooks:\n" + strings.Join(report, "\n")
+}
+
+// runHook runs one hook command and returns its output, or a note when it failed
+func runHook(hook config.Hook, argv []string) string {
+	timeout := time.Duration(hook.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	slog.Info("Post-edit hook", "command", argv)
+	output, err := exec.CommandContext(ctx, ResolveBinary(argv[0]), argv[1:]...).CombinedOutput()
+	text := strings.TrimSpace(string(output))
+	if err == nil && text == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ %s\n", strings.Join(argv, " "))
+	if text != "" {
+		b.WriteString(text + "\n")
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		fmt.Fprintf(&b, "(timed out after %s)", timeout)
+	case errors.As(err, &exitErr):
+		fmt.Fprintf(&b, "(exit code %d)", exitErr.ExitCode())
+	case err != nil:
+		fmt.Fprintf(&b, "(failed: %v)", err)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
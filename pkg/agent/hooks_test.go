@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bethel-nz/trace/pkg/config"
+)
+
+func TestPostEditHooks(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Cleanup(func() { PostEditHooks = nil })
+	err := ConfigureHooks([]config.Hook{
+		// A formatter that rewrites the file
+		{Glob: "*.txt", Command: "sh", Args: []string{"-c", `tr a-z A-Z < "$1" > "$1.tmp" && mv "$1.tmp" "$1"`, "sh", "{file}"}},
+		// A linter that reports a problem
+		{Glob: "docs/*.txt", Command: "sh", Args: []string{"-c", `echo "problem in $0"; exit 2`}},
+		{Glob: "*.go", Command: "false"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.MkdirAll("docs", 0755)
+	result, err := callTool(t, WriteFile, WriteFileInput{Path: "docs/a.txt", Content: "hello\n"})
+	if err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	expectContent(t, "docs/a.txt", "HELLO\n")
+	for _, want := range []string{"problem in docs/a.txt", "(exit code 2)", "rewritten by the hooks"} {
+		if !strings.Contains(result.Content, want) {
+			t.Errorf("Expected %q in the result, got:\n%s", want, result.Content)
+		}
+	}
+	if strings.Contains(result.Content, "false") {
+		t.Errorf("Expected the *.go hook not to run, got:\n%s", result.Content)
+	}
+
+	// The model hasn't seen the hook's rewrite, so editing needs a fresh read first
+	edit := EditFileInput{Path: "docs/a.txt", SearchText: "HELLO", ReplaceText: "bye"}
+	if _, err := callTool(t, EditFile, edit); err == nil || !strings.Contains(err.Error(), "modified on disk") {
+		t.Fatalf("Expected EditFile after a hook rewrite to ask for a re-read, got %v", err)
+	}
+	if _, err := callTool(t, ReadFile, ReadFileInput{Path: "docs/a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := callTool(t, EditFile, edit); err != nil {
+		t.Fatalf("EditFile after reading the rewrite failed: %v", err)
+	}
+
+	if result, _ := callTool(t, WriteFile, WriteFileInput{Path: "b.txt", Content: "UPPER\n"}); !strings.Contains(result.Content, "Post-edit hooks: 1 passed.") {
+		t.Errorf("Expected a clean hook run reported, got:\n%s", result.Content)
+	}
+	if result, _ := callTool(t, WriteFile, WriteFileInput{Path: "c.md", Content: "x\n"}); strings.Contains(result.Content, "hooks") {
+		t.Errorf("Expected no hooks for c.md, got:\n%s", result.Content)
+	}
+
+	if err := ConfigureHooks([]config.Hook{{Glob: "[", Command: "gofmt"}}); err == nil {
+		t.Error("Expected an invalid glob to be rejected")
+	}
+}
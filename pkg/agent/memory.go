@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bethel-nz/trace/pkg/config"
+)
+
+// MemoryFileName is the project instruction file Trace looks for
+const MemoryFileName = "TRACE.md"
+
+// MemoryFile is a discovered instruction file and where it came from
+type MemoryFile struct {
+	Path    string
+	Scope   string // "user" or "project"
+	Content string
+}
+
+// UserMemoryPath returns the user-global memory file (~/.config/trace/TRACE.md on Linux)
+func UserMemoryPath() string {
+	dir := config.UserDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, MemoryFileName)
+}
+
+// ProjectMemoryPath returns the memory file at the repo root, or in cwd outside of git
+func ProjectMemoryPath() string {
+	out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err == nil {
+		if root := strings.TrimSpace(string(out)); root != "" {
+			return filepath.Join(root, MemoryFileName)
+		}
+	}
+	return MemoryFileName
+}
+
+// FindMemoryFiles discovers instruction files, most general first:
+// the user-global file, then every TRACE.md from the filesystem root down to dir.
+func FindMemoryFiles(dir string) []MemoryFile {
+	var files []MemoryFile
+
+	if p := UserMemoryPath(); p != "" {
+		if content, err := os.ReadFile(p); err == nil {
+			files = append(files, MemoryFile{Path: p, Scope: "user", Content: string(content)})
+		}
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return files
+	}
+
+	// Walk up collecting candidates, then reverse so parents come before children
+	var candidates []string
+	for {
+		candidates = append(candidates, filepath.Join(abs, MemoryFileName))
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			break
+		}
+		abs = parent
+	}
+	for i := len(candidates) - 1; i >= 0; i-- {
+		content, err := os.ReadFile(candidates[i])
+		if err != nil {
+			continue
+		}
+		files = append(files, MemoryFile{Path: candidates[i], Scope: "project", Content: string(content)})
+	}
+
+	return files
+}
+
+// WithMemory appends every discovered memory file to the base system prompt
+func WithMemory(basePrompt string) string {
+	files := FindMemoryFiles(".")
+	if len(files) == 0 {
+		return basePrompt
+	}
+
+	var b strings.Builder
+	b.WriteString(basePrompt)
+	b.WriteString("\n\n<memory>\nThe following instructions were provided by the user in TRACE.md files. Later sections are more specific and take precedence.\n")
+	for _, f := range files {
+		content := strings.TrimSpace(f.Content)
+		if content == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## %s memory (%s)\n\n%s\n", strings.ToUpper(f.Scope[:1])+f.Scope[1:], f.Path, content)
+	}
+	b.WriteString("</memory>")
+	return b.String()
+}
+
+// AppendMemory adds a note as a bullet to the memory file, creating it if needed
+func AppendMemory(path, note string) error {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return fmt.Errorf("note is empty")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var b strings.Builder
+	if len(existing) == 0 {
+		b.WriteString("# Trace Memory\n\n")
+	} else if !strings.HasSuffix(string(existing), "\n") {
+		b.WriteString("\n")
+	}
+	// Keep multi-line notes inside a single bullet
+	b.WriteString("- " + strings.ReplaceAll(note, "\n", "\n  ") + "\n")
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(b.String())
+	return err
+}
+
+// --- Remember ---
+
+type RememberInput struct {
+	Note  string `json:"note" jsonschema_description:"A short, durable fact or instruction to remember for future sessions (e.g. build commands, conventions, user preferences)."`
+	Scope string `json:"scope,omitempty" jsonschema:"enum=project,enum=user" jsonschema_description:"Where to store the note: 'project' (TRACE.md at the repo root, default) or 'user' (global, applies to all projects)."`
+}
+
+var RememberDefinition = ToolDefinition{
+	Name:        "remember",
+	Description: "Append a durable note to the TRACE.md memory file so it is loaded into the system prompt in future sessions.",
+	Parameters:  GenerateSchema[RememberInput](),
+	Function:    Remember,
+}
+
+func Remember(input json.RawMessage) (ToolResult, error) {
+	var args RememberInput
+	if err := json.Unmarshal(input, &args); err != nil {
+		return ToolResult{}, err
+	}
+
+	path := ProjectMemoryPath()
+	switch args.Scope {
+	case "", "project":
+	case "user":
+		path = UserMemoryPath()
+		if path == "" {
+			return ToolResult{}, fmt.Errorf("could not determine user config directory")
+		}
+	default:
+		return ToolResult{}, fmt.Errorf("invalid scope: %s", args.Scope)
+	}
+
+	if err := AppendMemory(path, args.Note); err != nil {
+		return ToolResult{}, fmt.Errorf("failed to save memory: %w", err)
+	}
+
+	return ToolResult{Content: fmt.Sprintf("Remembered in %s", path)}, nil
+}
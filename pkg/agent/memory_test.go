@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindMemoryFiles(t *testing.T) {
+	// Setup: root/TRACE.md and root/sub/TRACE.md
+	root := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "config"))
+	sub := filepath.Join(root, "sub")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendMemory(filepath.Join(root, MemoryFileName), "parent note"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendMemory(filepath.Join(sub, MemoryFileName), "child note"); err != nil {
+		t.Fatal(err)
+	}
+
+	files := FindMemoryFiles(sub)
+	var found []string
+	for _, f := range files {
+		if strings.HasPrefix(f.Path, root) {
+			found = append(found, f.Content)
+		}
+	}
+
+	// Parents must come before children so more specific notes take precedence
+	if len(found) != 2 {
+		t.Fatalf("Expected 2 memory files, got %d", len(found))
+	}
+	if !strings.Contains(found[0], "- parent note") || !strings.Contains(found[1], "- child note") {
+		t.Errorf("Unexpected memory order: %q", found)
+	}
+}
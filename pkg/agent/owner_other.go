@@ -0,0 +1,8 @@
+//go:build !unix
+
+package agent
+
+import "os"
+
+// preserveOwner does nothing where files have no Unix owner
+func preserveOwner(path string, info os.FileInfo) {}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package agent
+
+import (
+	"os"
+	"syscall"
+)
+
+// preserveOwner gives path the owner and group of the file it replaces. It only
+// succeeds for root or when they already match, which covers the common cases.
+func preserveOwner(path string, info os.FileInfo) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		os.Lchown(path, int(st.Uid), int(st.Gid))
+	}
+}
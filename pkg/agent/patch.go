@@ -0,0 +1,495 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// --- Apply Patch ---
+
+type ApplyPatchInput struct {
+	Patch string `json:"patch" jsonschema_description:"A unified diff (as produced by 'git diff' or 'diff -u') covering one or more files. Use /dev/null as the old path to create a file and as the new path to delete one; 'rename from'/'rename to' lines rename a file. Include a few lines of unchanged context around each change."`
+}
+
+var ApplyPatchDefinition = ToolDefinition{
+	Name:        "apply_patch",
+	Description: "Apply a multi-file unified diff. Hunks may be off by some lines or differ in whitespace; every hunk is checked first and nothing is written unless all of them apply. Failed hunks are reported with the lines actually found so the patch can be corrected.",
+	Parameters:  GenerateSchema[ApplyPatchInput](),
+	Function:    ApplyPatch,
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// filePatch is the part of a patch for one file
+type filePatch struct {
+	OldPath, NewPath string // Empty for /dev/null
+	Hunks            []hunk
+}
+
+// hunk is one @@ section. Lines keep their ' ', '-' or '+' prefix.
+type hunk struct {
+	Header             string
+	OldStart, OldCount int
+	Lines              []string
+	OldNoEOL, NewNoEOL bool // "\ No newline at end of file" after the old or new side
+}
+
+// side returns the hunk's lines before (old) or after the change, without prefixes
+func (h hunk) side(old bool) []string {
+	var lines []string
+	for _, line := range h.Lines {
+		switch {
+		case line[0] == ' ', line[0] == '-' && old, line[0] == '+' && !old:
+			lines = append(lines, line[1:])
+		}
+	}
+	return lines
+}
+
+// fileState is a file as the patch sees it while hunks are applied in memory
+type fileState struct {
+	Content string
+	Exists  bool
+	Mode    os.FileMode
+}
+
+func ApplyPatch(input json.RawMessage) (ToolResult, error) {
+	var args ApplyPatchInput
+	if err := json.Unmarshal(input, &args); err != nil {
+		return ToolResult{}, err
+	}
+	patches, err := parsePatch(args.Patch)
+	if err != nil {
+		return ToolResult{}, err
+	}
+
+	// 1. Apply every file patch in memory, collecting all failures
+	files := make(map[string]*fileState)
+	var order []string
+	load := func(path string) (*fileState, error) {
+		if f, ok := files[path]; ok {
+			return f, nil
+		}
+		if err := checkPath(path); err != nil {
+			return nil, err
+		}
+		f := &fileState{Mode: 0644}
+		if info, err := os.Stat(path); err == nil {
+			if info.IsDir() {
+				return nil, fmt.Errorf("%s is a directory", path)
+			}
+			// The hunks' context shows what the model knows, so an unread file is fine
+			if err := checkFresh(path, false); err != nil {
+				return nil, err
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			f.Content, f.Exists, f.Mode = string(content), true, info.Mode().Perm()
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		files[path] = f
+		order = append(order, path)
+		return f, nil
+	}
+
+	var failures, notes, summary []string
+	for _, fp := range patches {
+		path := fp.NewPath
+		if path == "" {
+			path = fp.OldPath
+		}
+		var src, dst *fileState
+		if fp.OldPath != "" {
+			if src, err = load(fp.OldPath); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", fp.OldPath, err))
+				continue
+			}
+			if !src.Exists {
+				failures = append(failures, fmt.Sprintf("%s: file does not exist", fp.OldPath))
+				continue
+			}
+		}
+		if fp.NewPath != "" && fp.NewPath != fp.OldPath {
+			if dst, err = load(fp.NewPath); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", fp.NewPath, err))
+				continue
+			}
+			if dst.Exists {
+				failures = append(failures, fmt.Sprintf("%s: file already exists", fp.NewPath))
+				continue
+			}
+		}
+
+		before := ""
+		if src != nil {
+			before = src.Content
+		}
+		after, hunkNotes, hunkFailures := applyHunks(path, before, src == nil, fp.Hunks)
+		notes = append(notes, hunkNotes...)
+		if len(hunkFailures) > 0 {
+			failures = append(failures, hunkFailures...)
+			continue
+		}
+
+		switch {
+		case fp.NewPath == "":
+			src.Content, src.Exists = "", false
+			summary = append(summary, "D "+fp.OldPath)
+		case fp.OldPath == "":
+			dst.Content, dst.Exists = after, true
+			summary = append(summary, "A "+fp.NewPath)
+		case dst != nil:
+			dst.Content, dst.Exists, dst.Mode = after, true, src.Mode
+			src.Content, src.Exists = "", false
+			summary = append(summary, fmt.Sprintf("R %s -> %s", fp.OldPath, fp.NewPath))
+		default:
+			src.Content = after
+			summary = append(summary, "M "+fp.OldPath)
+		}
+	}
+	if len(failures) > 0 {
+		return ToolResult{}, fmt.Errorf("patch not applied, no files were changed:\n\n%s", strings.Join(failures, "\n\n"))
+	}
+
+	// 2. Write the results, restoring earlier files if a later write fails
+	if err := writePatchedFiles(files, order); err != nil {
+		return ToolResult{}, err
+	}
+
+	content := "Applied patch:\n" + strings.Join(summary, "\n")
+	if len(notes) > 0 {
+		content += "\n\n" + strings.Join(notes, "\n")
+	}
+	if hooks := runPostEditHooks(order); hooks != "" {
+		content += "\n\n" + hooks
+	}
+	return ToolResult{
+		Content:  content,
+		Metadata: map[string]any{"paths": order},
+	}, nil
+}
+
+// writePatchedFiles writes the changed files, then removes deleted ones. On failure the
+// files already written are put back as they were.
+func writePatchedFiles(files map[string]*fileState, order []string) error {
+	type original struct {
+		path    string
+		content []byte
+		existed bool
+	}
+	var done []original
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			if done[i].existed {
+				writeAtomic(done[i].path, done[i].content, files[done[i].path].Mode)
+			} else {
+				os.Remove(done[i].path)
+			}
+		}
+	}
+
+	// Deletions go last so a failed write never leaves a renamed file missing
+	for _, deleting := range []bool{false, true} {
+		for _, path := range order {
+			f := files[path]
+			old, readErr := os.ReadFile(path)
+			existed := readErr == nil
+			if f.Exists == deleting || (!f.Exists && !existed) || (f.Exists && existed && string(old) == f.Content) {
+				continue
+			}
+			beforeWrite(path)
+			var err error
+			if f.Exists {
+				if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+					err = writeAtomic(path, []byte(f.Content), f.Mode)
+				}
+			} else {
+				err = os.Remove(path)
+			}
+			if err != nil {
+				rollback()
+				return fmt.Errorf("failed to write %s, no files were changed: %v", path, err)
+			}
+			done = append(done, original{path, old, existed})
+		}
+	}
+	for _, path := range order {
+		if files[path].Exists {
+			recordVersion(path, []byte(files[path].Content))
+		} else {
+			forgetVersion(path)
+		}
+	}
+	return nil
+}
+
+// applyHunks applies hunks in order to content. Each hunk is matched at the position
+// closest to its header line, first exactly, then ignoring trailing whitespace, then
+// ignoring all whitespace differences. It returns notes on hunks that needed fuzz and a
+// failure message per hunk that did not match.
+func applyHunks(path, content string, create bool, hunks []hunk) (string, []string, []string) {
+	// CRLF and BOM files are patched as plain LF text and converted back
+	content, format := decodeText(content)
+	eol := create || content == "" || strings.HasSuffix(content, "\n") // An empty file is filled like a new one
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	var out, notes, failures []string
+	cursor, offset := 0, 0 // Next unconsumed line, and how far the file has drifted from the headers
+	for n, h := range hunks {
+		old := h.side(true)
+		expected := max(h.OldStart-1, 0)
+		if h.OldCount == 0 && len(old) == 0 {
+			expected = h.OldStart // Pure insertions come after the header line
+		}
+		expected = min(max(expected+offset, cursor), len(lines))
+
+		at, fuzz := expected, 0
+		if len(old) > 0 {
+			at, fuzz = findHunk(lines, old, cursor, expected)
+		}
+		if at < 0 {
+			failures = append(failures, hunkFailure(path, n+1, h, lines, expected, old))
+			continue
+		}
+		if at != expected || fuzz > 0 {
+			note := fmt.Sprintf("%s: hunk %d applied at line %d", path, n+1, at+1)
+			if at != expected {
+				note += fmt.Sprintf(" (offset %+d)", at-expected)
+			}
+			if fuzz > 0 {
+				note += " ignoring whitespace differences"
+			}
+			notes = append(notes, note)
+		}
+
+		out = append(out, lines[cursor:at]...)
+		i := at
+		for _, line := range h.Lines {
+			switch line[0] {
+			case ' ':
+				out = append(out, lines[i]) // The file's version, in case whitespace differed
+				i++
+			case '-':
+				i++
+			case '+':
+				out = append(out, line[1:])
+			}
+		}
+		if i == len(lines) {
+			if h.NewNoEOL {
+				eol = false
+			} else if h.OldNoEOL {
+				eol = true
+			}
+		}
+		offset += at - expected
+		cursor = i
+	}
+	out = append(out, lines[cursor:]...)
+
+	result := strings.Join(out, "\n")
+	if len(out) > 0 && eol {
+		result += "\n"
+	}
+	return format.encode(result), notes, failures
+}
+
+// findHunk returns where old occurs at or after from, closest to expected, and the
+// whitespace fuzz needed to match it, or -1 when it does not occur
+func findHunk(lines, old []string, from, expected int) (int, int) {
+	for fuzz := 0; fuzz <= 2; fuzz++ {
+		best := -1
+		for i := from; i+len(old) <= len(lines); i++ {
+			if matchLines(lines[i:i+len(old)], old, fuzz) && (best < 0 || abs(i-expected) < abs(best-expected)) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			return best, fuzz
+		}
+	}
+	return -1, 0
+}
+
+func matchLines(lines, want []string, fuzz int) bool {
+	for i := range want {
+		a, b := lines[i], want[i]
+		switch fuzz {
+		case 1:
+			a, b = strings.TrimRight(a, " \t\r"), strings.TrimRight(b, " \t\r")
+		case 2:
+			a, b = strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " ")
+		}
+		if a != b {
+			return false
+		}
+	}
+	return true
+}
+
+// hunkFailure describes a hunk that did not match, with the lines the file has where it was expected
+func hunkFailure(path string, n int, h hunk, lines []string, expected int, old []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: hunk %d (%s) does not match the file.\nExpected near line %d:\n", path, n, h.Header, expected+1)
+	for _, line := range old {
+		b.WriteString("  " + line + "\n")
+	}
+	end := min(expected+max(len(old), 1), len(lines))
+	if expected >= end {
+		b.WriteString("The file has no lines there.")
+		return b.String()
+	}
+	b.WriteString("The file has:\n")
+	for _, line := range lines[expected:end] {
+		b.WriteString("  " + line + "\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// parsePatch splits a unified diff into file patches. Text outside the diff is ignored.
+func parsePatch(text string) ([]filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var patches []filePatch
+	var current *filePatch
+	gitHeader := false // The current file started with "diff --git", so paths carry a/ and b/
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			patches = append(patches, filePatch{})
+			current, gitHeader = &patches[len(patches)-1], true
+			if a, b, ok := strings.Cut(strings.TrimPrefix(line, "diff --git "), " b/"); ok {
+				current.OldPath, current.NewPath = strings.TrimPrefix(a, "a/"), b
+			}
+
+		case strings.HasPrefix(line, "GIT binary patch"), strings.HasPrefix(line, "Binary files "):
+			return nil, fmt.Errorf("binary patches are not supported")
+
+		case current != nil && len(current.Hunks) == 0 && strings.HasPrefix(line, "rename from "):
+			current.OldPath = strings.TrimPrefix(line, "rename from ")
+		case current != nil && len(current.Hunks) == 0 && strings.HasPrefix(line, "rename to "):
+			current.NewPath = strings.TrimPrefix(line, "rename to ")
+		case current != nil && len(current.Hunks) == 0 && strings.HasPrefix(line, "new file mode"):
+			current.OldPath = ""
+		case current != nil && len(current.Hunks) == 0 && strings.HasPrefix(line, "deleted file mode"):
+			current.NewPath = ""
+
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			// A plain diff starts a file here; in a git diff these lines repeat the header
+			if current == nil || len(current.Hunks) > 0 || !gitHeader {
+				patches = append(patches, filePatch{})
+				current, gitHeader = &patches[len(patches)-1], false
+			}
+			oldPath, newPath := patchPath(line[4:]), patchPath(lines[i+1][4:])
+			if gitHeader || (oldPath == "" || strings.HasPrefix(oldPath, "a/")) && (newPath == "" || strings.HasPrefix(newPath, "b/")) {
+				oldPath, newPath = strings.TrimPrefix(oldPath, "a/"), strings.TrimPrefix(newPath, "b/")
+			}
+			current.OldPath, current.NewPath = oldPath, newPath
+			i++
+
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: hunk before any file header (--- and +++ lines)", i+1)
+			}
+			h, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			current.Hunks = append(current.Hunks, h)
+			i = next - 1
+
+		case current != nil && len(current.Hunks) > 0 && strings.TrimSpace(line) != "":
+			// Prose between files ends the current one
+			current = nil
+		}
+	}
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file changes found in the patch; expected unified diff headers (--- a/path, +++ b/path) and @@ hunks")
+	}
+	for _, fp := range patches {
+		if fp.OldPath == "" && fp.NewPath == "" {
+			return nil, fmt.Errorf("a file in the patch has no path")
+		}
+		if fp.OldPath != "" && fp.NewPath != "" && fp.OldPath == fp.NewPath && len(fp.Hunks) == 0 {
+			return nil, fmt.Errorf("%s: no hunks in the patch", fp.OldPath)
+		}
+	}
+	return patches, nil
+}
+
+// parseHunk reads the hunk starting at lines[start] and returns the index of the line after it.
+// Blank lines count as empty context, since trailing spaces are often lost in transit.
+func parseHunk(lines []string, start int) (hunk, int, error) {
+	match := hunkHeaderRe.FindStringSubmatch(lines[start])
+	if match == nil {
+		return hunk{}, 0, fmt.Errorf("line %d: malformed hunk header %q, expected @@ -start,count +start,count @@", start+1, lines[start])
+	}
+	h := hunk{Header: strings.TrimSpace(match[0]), OldCount: 1}
+	h.OldStart, _ = strconv.Atoi(match[1])
+	if match[2] != "" {
+		h.OldCount, _ = strconv.Atoi(match[2])
+	}
+
+	i := start + 1
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			line = " "
+		}
+		switch line[0] {
+		case ' ', '-', '+':
+			if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+				return trimHunk(h), i, nil
+			}
+			h.Lines = append(h.Lines, line)
+			continue
+		case '\\':
+			if n := len(h.Lines); n > 0 {
+				last := h.Lines[n-1][0]
+				h.OldNoEOL = h.OldNoEOL || last != '+'
+				h.NewNoEOL = h.NewNoEOL || last != '-'
+			}
+			continue
+		}
+		break
+	}
+	return trimHunk(h), i, nil
+}
+
+// trimHunk drops blank lines that followed the hunk, which were read as empty context
+func trimHunk(h hunk) hunk {
+	for len(h.Lines) > 0 && h.Lines[len(h.Lines)-1] == " " && len(h.side(true)) > h.OldCount {
+		h.Lines = h.Lines[:len(h.Lines)-1]
+	}
+	return h
+}
+
+// patchPath reads a path from a ---/+++ line, dropping any timestamp. /dev/null becomes empty.
+func patchPath(s string) string {
+	s, _, _ = strings.Cut(s, "\t")
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return ""
+	}
+	return s
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func applyPatch(t *testing.T, patch string) (ToolResult, error) {
+	t.Helper()
+	input, _ := json.Marshal(ApplyPatchInput{Patch: patch})
+	return ApplyPatch(input)
+}
+
+func expectContent(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil || string(got) != want {
+		t.Errorf("Expected %s to contain %q, got %q (%v)", path, want, got, err)
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("main.go", []byte("package main\n\n// added above\nfunc main() {\n\tprintln(\"hi\")   \n}\n"), 0644)
+	os.WriteFile("old.txt", []byte("moved\n"), 0755)
+	os.WriteFile("gone.txt", []byte("bye\n"), 0644)
+
+	// The hunk header is two lines off and the context lost its trailing spaces
+	patch := `Here is the change:
+
+diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,4 @@
+ func main() {
+-	println("hi")
++	println("hello")
+ }
+diff --git a/new/file.txt b/new/file.txt
+new file mode 100644
+--- /dev/null
++++ b/new/file.txt
+@@ -0,0 +1,2 @@
++first
++second
+\ No newline at end of file
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+diff --git a/old.txt b/renamed.txt
+similarity index 100%
+rename from old.txt
+rename to renamed.txt
+`
+	result, err := applyPatch(t, patch)
+	if err != nil {
+		t.Fatalf("ApplyPatch failed: %v", err)
+	}
+	for _, want := range []string{"M main.go", "A new/file.txt", "D gone.txt", "R old.txt -> renamed.txt", "hunk 1 applied at line 4 (offset +3)"} {
+		if !strings.Contains(result.Content, want) {
+			t.Errorf("Expected %q in the result, got:\n%s", want, result.Content)
+		}
+	}
+	expectContent(t, "main.go", "package main\n\n// added above\nfunc main() {\n\tprintln(\"hello\")\n}\n")
+	expectContent(t, "new/file.txt", "first\nsecond")
+	expectContent(t, "renamed.txt", "moved\n")
+	if _, err := os.Stat("gone.txt"); !os.IsNotExist(err) {
+		t.Error("Expected gone.txt to be deleted")
+	}
+	if _, err := os.Stat("old.txt"); !os.IsNotExist(err) {
+		t.Error("Expected old.txt to be renamed")
+	}
+	if info, err := os.Stat("renamed.txt"); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Expected the rename to keep the file mode, got %v", info.Mode())
+	}
+}
+
+func TestApplyPatchAtomic(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("a.txt", []byte("one\ntwo\nthree\n"), 0644)
+	os.WriteFile("b.txt", []byte("alpha\nbeta\n"), 0644)
+
+	// a.txt applies, but the second hunk of b.txt does not
+	patch := `--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++2
+ three
+--- a/b.txt
++++ b/b.txt
+@@ -1,1 +1,1 @@
+-alpha
++ALPHA
+@@ -2,1 +2,1 @@
+-gamma
++GAMMA
+`
+	_, err := applyPatch(t, patch)
+	if err == nil {
+		t.Fatal("Expected the patch to fail")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "b.txt: hunk 2 (@@ -2,1 +2,1 @@)") || !strings.Contains(msg, "  beta") || strings.Contains(msg, "hunk 1") {
+		t.Errorf("Expected only hunk 2 reported with the lines found, got:\n%s", msg)
+	}
+	expectContent(t, "a.txt", "one\ntwo\nthree\n")
+	expectContent(t, "b.txt", "alpha\nbeta\n")
+}
+
+func TestApplyPatchChecksFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("exists.txt", []byte("x\n"), 0644)
+
+	cases := map[string]string{
+		"--- /dev/null\n+++ b/exists.txt\n@@ -0,0 +1 @@\n+y\n":        "already exists",
+		"--- a/missing.txt\n+++ b/missing.txt\n@@ -1 +1 @@\n-a\n+b\n": "does not exist",
+		"--- a/.env\n+++ b/.env\n@@ -1 +1 @@\n-a\n+b\n":               "access denied",
+		"just some text": "no file changes found",
+	}
+	for patch, want := range cases {
+		if _, err := applyPatch(t, patch); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q for patch %q, got %v", want, patch, err)
+		}
+	}
+}
+
+func TestApplyPatchCRLF(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("win.txt", []byte("one\r\ntwo\r\n"), 0644)
+
+	if _, err := applyPatch(t, "--- win.txt\n+++ win.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+three\n"); err != nil {
+		t.Fatalf("ApplyPatch failed: %v", err)
+	}
+	expectContent(t, "win.txt", "one\r\nthree\r\n")
+}
+
+func TestApplyPatchEmptyFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("empty.txt", nil, 0644)
+	os.WriteFile("noeol.txt", nil, 0644)
+
+	if _, err := applyPatch(t, "--- empty.txt\n+++ empty.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n"); err != nil {
+		t.Fatalf("ApplyPatch failed: %v", err)
+	}
+	expectContent(t, "empty.txt", "one\ntwo\n")
+
+	if _, err := applyPatch(t, "--- noeol.txt\n+++ noeol.txt\n@@ -0,0 +1 @@\n+one\n\\ No newline at end of file\n"); err != nil {
+		t.Fatalf("ApplyPatch failed: %v", err)
+	}
+	expectContent(t, "noeol.txt", "one")
+}
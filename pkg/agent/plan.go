@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Checklist item statuses, shared by plans and todos
+const (
+	StatusPending    = "pending"
+	StatusInProgress = "in_progress"
+	StatusDone       = "done"
+	StatusSkipped    = "skipped"
+)
+
+// PlanItem is one step of an approved plan or one entry of the todo list
+type PlanItem struct {
+	Text   string `json:"text" jsonschema_description:"Short, imperative description of the step."`
+	Status string `json:"status" jsonschema:"enum=pending,enum=in_progress,enum=done,enum=skipped" jsonschema_description:"Current status of the step."`
+}
+
+// PlanModeInstruction is sent with every request while the session is in plan mode
+const PlanModeInstruction = `You are in PLAN MODE. You may only use read-only tools to explore the codebase; do not modify files or run commands.
+Investigate as needed, then end your reply with a numbered plan (1., 2., 3., ...) of concrete steps. The user will review it before anything is executed.`
+
+// PlanApprovedMessage starts execution once the user approves a plan
+const PlanApprovedMessage = "The plan is approved. Execute it step by step. Call update_plan to mark each step in_progress before you start it and done when it is finished."
+
+// Top-level numbered items only; nested lists are indented by two or more spaces
+var planStepRe = regexp.MustCompile(`^ ?(\d+)[.)]\s+(.+)$`)
+
+// ParsePlan extracts the last numbered list from a model reply.
+// Only top-level items are kept; a new list starting at 1 replaces any earlier one.
+func ParsePlan(text string) []PlanItem {
+	var items []PlanItem
+	for _, line := range strings.Split(text, "\n") {
+		match := planStepRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if match[1] == "1" {
+			items = nil
+		}
+		step := strings.ReplaceAll(strings.TrimSpace(match[2]), "**", "") // Drop markdown bold around step titles
+		items = append(items, PlanItem{Text: step, Status: StatusPending})
+	}
+	return items
+}
+
+// --- Update Plan ---
+
+type UpdatePlanInput struct {
+	Step   int    `json:"step" jsonschema_description:"The 1-based number of the plan step to update."`
+	Status string `json:"status" jsonschema:"enum=pending,enum=in_progress,enum=done,enum=skipped" jsonschema_description:"The new status of the step."`
+}
+
+var UpdatePlanDefinition = ToolDefinition{
+	Name:        "update_plan",
+	Description: "Mark a step of the approved plan as pending, in_progress, done or skipped so the user can follow progress.",
+	Parameters:  GenerateSchema[UpdatePlanInput](),
+	Function:    UpdatePlan,
+	UIOnly:      true,
+}
+
+// UpdatePlan only validates input; the plan itself lives in the TUI
+func UpdatePlan(input json.RawMessage) (ToolResult, error) {
+	if _, err := ParseUpdatePlan(input); err != nil {
+		return ToolResult{}, err
+	}
+	return ToolResult{}, fmt.Errorf("update_plan must be run by the Trace TUI")
+}
+
+// ParseUpdatePlan decodes and validates update_plan arguments
+func ParseUpdatePlan(input json.RawMessage) (UpdatePlanInput, error) {
+	var args UpdatePlanInput
+	if err := json.Unmarshal(input, &args); err != nil {
+		return args, err
+	}
+	if args.Step < 1 {
+		return args, fmt.Errorf("step must be 1 or greater")
+	}
+	if !validStatus(args.Status) {
+		return args, fmt.Errorf("invalid status: %s", args.Status)
+	}
+	return args, nil
+}
+
+func validStatus(status string) bool {
+	switch status {
+	case StatusPending, StatusInProgress, StatusDone, StatusSkipped:
+		return true
+	}
+	return false
+}
+
+// FormatChecklist renders items as a markdown checklist for tool results and saved sessions
+func FormatChecklist(items []PlanItem) string {
+	var b strings.Builder
+	for i, item := range items {
+		box := "[ ]"
+		switch item.Status {
+		case StatusDone:
+			box = "[x]"
+		case StatusInProgress:
+			box = "[~]"
+		case StatusSkipped:
+			box = "[-]"
+		}
+		fmt.Fprintf(&b, "%s %d. %s\n", box, i+1, item.Text)
+	}
+	return b.String()
+}
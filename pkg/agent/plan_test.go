@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParsePlan(t *testing.T) {
+	reply := `I looked around. Some notes:
+
+1. Not a plan, just an aside
+
+Here is the plan:
+
+1. **Add** the config field
+2. Wire it into InvokeAI
+   1. nested detail that should be ignored
+3) Update the README`
+
+	items := ParsePlan(reply)
+	expected := []string{"Add the config field", "Wire it into InvokeAI", "Update the README"}
+	if len(items) != len(expected) {
+		t.Fatalf("Expected %d steps, got %d: %+v", len(expected), len(items), items)
+	}
+	for i, want := range expected {
+		if items[i].Text != want || items[i].Status != StatusPending {
+			t.Errorf("Step %d: expected %q pending, got %+v", i+1, want, items[i])
+		}
+	}
+
+	if items := ParsePlan("No numbered list here."); len(items) != 0 {
+		t.Errorf("Expected no steps, got %+v", items)
+	}
+}
+
+func TestParseUpdatePlan(t *testing.T) {
+	if _, err := ParseUpdatePlan(json.RawMessage(`{"step":2,"status":"done"}`)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := ParseUpdatePlan(json.RawMessage(`{"step":0,"status":"done"}`)); err == nil {
+		t.Error("Expected error for step 0, got nil")
+	}
+	if _, err := ParseUpdatePlan(json.RawMessage(`{"step":1,"status":"finished"}`)); err == nil {
+		t.Error("Expected error for invalid status, got nil")
+	}
+}
+
+func TestParseTodoWrite(t *testing.T) {
+	args, err := ParseTodoWrite(json.RawMessage(`{"todos":[{"text":"Write tests","status":"in_progress"},{"text":"Update docs"}]}`))
+	if err != nil {
+		t.Fatalf("ParseTodoWrite failed: %v", err)
+	}
+	if args.Todos[1].Status != StatusPending {
+		t.Errorf("Expected missing status to default to pending, got %q", args.Todos[1].Status)
+	}
+
+	if _, err := ParseTodoWrite(json.RawMessage(`{"todos":[{"text":"","status":"done"}]}`)); err == nil {
+		t.Error("Expected error for empty todo, got nil")
+	}
+}
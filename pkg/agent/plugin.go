@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bethel-nz/trace/pkg/config"
+
+	"github.com/invopop/jsonschema"
+)
+
+// pluginResponse is the JSON a plugin prints on stdout
+type pluginResponse struct {
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+}
+
+// NewPluginTool builds a ToolDefinition that runs an external executable declared in config.
+// A plugin may not take the name of a registered tool, so it can't replace a built-in.
+func NewPluginTool(spec config.Plugin) (ToolDefinition, error) {
+	if spec.Name == "" {
+		return ToolDefinition{}, fmt.Errorf("plugin is missing a name")
+	}
+	if _, exists := DefaultRegistry.Get(spec.Name); exists {
+		return ToolDefinition{}, fmt.Errorf("plugin %s has the name of an existing tool; rename it", spec.Name)
+	}
+	if spec.Command == "" {
+		return ToolDefinition{}, fmt.Errorf("plugin %s is missing a command", spec.Name)
+	}
+
+	// Tools without declared parameters take an empty object
+	schema := jsonschema.Schema{Type: "object"}
+	if len(spec.Parameters) > 0 {
+		if err := json.Unmarshal(spec.Parameters, &schema); err != nil {
+			return ToolDefinition{}, fmt.Errorf("plugin %s has an invalid schema: %w", spec.Name, err)
+		}
+	}
+
+	timeout := time.Duration(spec.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+
+	return ToolDefinition{
+		Name:        spec.Name,
+		Description: spec.Description,
+		Parameters:  schema,
+		Function: func(input json.RawMessage) (ToolResult, error) {
+			output, err := runPlugin(spec, timeout, input)
+			if err != nil {
+				return ToolResult{}, err
+			}
+			return ToolResult{Content: output}, nil
+		},
+	}, nil
+}
+
+func runPlugin(spec config.Plugin, timeout time.Duration, input json.RawMessage) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if len(input) == 0 {
+		input = json.RawMessage("{}")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ResolveBinary(spec.Command), spec.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("plugin %s timed out after %s", spec.Name, timeout)
+		}
+		return "", fmt.Errorf("plugin %s failed: %v\n%s", spec.Name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var resp pluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return "", fmt.Errorf("plugin %s returned invalid JSON: %v\nOutput:\n%s", spec.Name, err, stdout.String())
+	}
+	if resp.Error != "" {
+		return "", errors.New(resp.Error)
+	}
+	return resp.Output, nil
+}
@@ -0,0 +1,29 @@
+package agent
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/bethel-nz/trace/pkg/config"
+)
+
+// ListProjectFiles returns the files in the current project, respecting .gitignore.
+// It is used to populate the @ autocomplete and is cheap enough to call after every turn.
+func ListProjectFiles() ([]string, error) {
+	cmd := exec.Command("git", "ls-files", "-c", "-o", "--exclude-standard")
+	out, err := cmd.Output()
+	if err != nil {
+		// Fallback for non-git
+		return []string{}, err
+	}
+
+	lines := strings.Split(string(out), "\n")
+	var clean []string
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if l != "" && !strings.HasPrefix(l, ".git") && !strings.HasPrefix(l, config.ProjectDir+"/") && l != "agent" && l != "trace" && !strings.HasPrefix(l, "bin/") && l != ".env" {
+			clean = append(clean, l)
+		}
+	}
+	return clean, nil
+}
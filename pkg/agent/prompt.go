@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/invopop/jsonschema"
+)
+
+// PromptData holds the live environment facts available to the system prompt template
+type PromptData struct {
+	OS          string
+	Shell       string
+	Cwd         string
+	GitBranch   string
+	Date        string
+	Tools       []ToolDefinition
+	ToolSection string // Markdown documentation generated from Tools
+}
+
+// NewPromptData gathers the current environment for rendering the system prompt
+func NewPromptData(tools []ToolDefinition) PromptData {
+	cwd, _ := os.Getwd()
+
+	shell := os.Getenv("SHELL")
+	if shell == "" && runtime.GOOS == "windows" {
+		shell = os.Getenv("COMSPEC")
+	}
+	if shell == "" {
+		shell = "unknown"
+	}
+
+	branch := "(not a git repository)"
+	if out, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output(); err == nil {
+		branch = strings.TrimSpace(string(out))
+	}
+
+	return PromptData{
+		OS:          runtime.GOOS + "/" + runtime.GOARCH,
+		Shell:       shell,
+		Cwd:         cwd,
+		GitBranch:   branch,
+		Date:        time.Now().Format("2006-01-02 (Monday)"),
+		Tools:       tools,
+		ToolSection: DescribeTools(tools),
+	}
+}
+
+// RenderSystemPrompt executes the system prompt template against the current environment
+func RenderSystemPrompt(tmpl string, tools []ToolDefinition) (string, error) {
+	t, err := template.New("system_prompt").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse system prompt template: %w", err)
+	}
+
+	var b strings.Builder
+	if err := t.Execute(&b, NewPromptData(tools)); err != nil {
+		return "", fmt.Errorf("failed to render system prompt: %w", err)
+	}
+	return b.String(), nil
+}
+
+// DescribeTools renders markdown documentation for each tool from its definition and schema,
+// so the prompt always matches what is actually registered.
+func DescribeTools(tools []ToolDefinition) string {
+	var b strings.Builder
+	for i, tool := range tools {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "## %s\n\nDescription: %s\n", tool.Name, tool.Description)
+
+		props := tool.Parameters.Properties
+		if props == nil || props.Len() == 0 {
+			b.WriteString("Input: none\n")
+			continue
+		}
+
+		b.WriteString("Input:\n\n")
+		for pair := props.Oldest(); pair != nil; pair = pair.Next() {
+			optional := ""
+			if !slices.Contains(tool.Parameters.Required, pair.Key) {
+				optional = ", optional"
+			}
+			fmt.Fprintf(&b, "- `%s` (%s%s)", pair.Key, describeType(pair.Value), optional)
+			if pair.Value.Description != "" {
+				fmt.Fprintf(&b, " - %s", pair.Value.Description)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// describeType renders a schema type such as "string", "array of string" or "\"open\" | \"close\""
+func describeType(s *jsonschema.Schema) string {
+	if len(s.Enum) > 0 {
+		var values []string
+		for _, v := range s.Enum {
+			values = append(values, fmt.Sprintf("%q", fmt.Sprint(v)))
+		}
+		return strings.Join(values, " | ")
+	}
+	if s.Type == "array" && s.Items != nil {
+		return "array of " + describeType(s.Items)
+	}
+	if s.Type == "" {
+		return "any"
+	}
+	return s.Type
+}
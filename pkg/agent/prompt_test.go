@@ -0,0 +1,30 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderSystemPrompt(t *testing.T) {
+	tools := []ToolDefinition{ReadFileDefinition, RunCommandDefinition}
+
+	prompt, err := RenderSystemPrompt("OS={{.OS}}\n{{.ToolSection}}", tools)
+	if err != nil {
+		t.Fatalf("RenderSystemPrompt failed: %v", err)
+	}
+
+	// Every registered tool and its parameters must be documented
+	for _, want := range []string{"## read_file", "- `path` (string)", "## run_command", "- `args` (array of string)"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected prompt to contain %q, got:\n%s", want, prompt)
+		}
+	}
+	if strings.Contains(prompt, "{{") || strings.HasPrefix(prompt, "OS=\n") {
+		t.Errorf("Template variables were not rendered:\n%s", prompt)
+	}
+
+	// Broken templates surface an error instead of a half-rendered prompt
+	if _, err := RenderSystemPrompt("{{.Missing", tools); err == nil {
+		t.Error("Expected error for invalid template, got nil")
+	}
+}
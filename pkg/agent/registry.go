@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Registry holds the tools available to the agent, in registration order
+type Registry struct {
+	mu       sync.RWMutex
+	tools    map[string]ToolDefinition
+	order    []string
+	disabled map[string]bool
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		tools:    make(map[string]ToolDefinition),
+		disabled: make(map[string]bool),
+	}
+}
+
+// DefaultRegistry is the registry used by GetAllToolDefinitions and ExecuteToolByName.
+// Built-in tools register themselves at init.
+var DefaultRegistry = NewRegistry()
+
+// Register adds a tool to the default registry
+func Register(def ToolDefinition) {
+	DefaultRegistry.Register(def)
+}
+
+// Register adds a tool, replacing any existing tool with the same name
+func (r *Registry) Register(def ToolDefinition) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tools[def.Name]; !exists {
+		r.order = append(r.order, def.Name)
+	}
+	r.tools[def.Name] = def
+}
+
+// SetEnabled enables or disables a registered tool. Disabled tools are hidden from the model
+// and refuse to execute.
+func (r *Registry) SetEnabled(name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tools[name]; !ok {
+		return fmt.Errorf("unknown tool: %s", name)
+	}
+	if enabled {
+		delete(r.disabled, name)
+	} else {
+		r.disabled[name] = true
+	}
+	return nil
+}
+
+// Configure applies an allowlist and a denylist. An empty allowlist enables every tool.
+func (r *Registry) Configure(enabled, disabled []string) error {
+	if len(enabled) > 0 {
+		allowed := make(map[string]bool, len(enabled))
+		for _, name := range enabled {
+			allowed[name] = true
+		}
+		for _, name := range r.Names() {
+			if err := r.SetEnabled(name, allowed[name]); err != nil {
+				return err
+			}
+		}
+		for name := range allowed {
+			if _, ok := r.Get(name); !ok {
+				return fmt.Errorf("unknown tool in enabled list: %s", name)
+			}
+		}
+	}
+	for _, name := range disabled {
+		if err := r.SetEnabled(name, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Names returns the names of every registered tool, enabled or not
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, len(r.order))
+	copy(names, r.order)
+	return names
+}
+
+// Get returns a registered tool by name, even if it is disabled
+func (r *Registry) Get(name string) (ToolDefinition, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	def, ok := r.tools[name]
+	return def, ok
+}
+
+// Enabled returns the enabled tools in registration order
+func (r *Registry) Enabled() []ToolDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	defs := make([]ToolDefinition, 0, len(r.order))
+	for _, name := range r.order {
+		if r.disabled[name] {
+			continue
+		}
+		defs = append(defs, r.tools[name])
+	}
+	return defs
+}
+
+// Execute runs an enabled tool by name with JSON arguments.
+// Unknown or disabled tools and tool errors come back as error results.
+func (r *Registry) Execute(name string, argsJSON json.RawMessage) ToolResult {
+	r.mu.RLock()
+	def, ok := r.tools[name]
+	disabled := r.disabled[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return ErrorResult(fmt.Errorf("unknown tool: %s", name))
+	}
+	if disabled {
+		return ErrorResult(fmt.Errorf("tool %s is disabled", name))
+	}
+	result, err := def.Function(argsJSON)
+	if err != nil {
+		return ErrorResult(err)
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bethel-nz/trace/pkg/config"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Register(ReadFileDefinition)
+	r.Register(ListFilesDefinition)
+	r.Register(WriteFileDefinition)
+
+	// Test Case 1: Denylist hides the tool and blocks execution
+	if err := r.Configure(nil, []string{"write_file"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Enabled()) != 2 {
+		t.Errorf("Expected 2 enabled tools, got %d", len(r.Enabled()))
+	}
+	if result := r.Execute("write_file", json.RawMessage(`{}`)); !result.IsError || !strings.Contains(result.Content, "disabled") {
+		t.Errorf("Expected disabled error, got %+v", result)
+	}
+
+	// Test Case 2: Allowlist keeps registration order
+	if err := r.Configure([]string{"list_files", "read_file"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	enabled := r.Enabled()
+	if len(enabled) != 2 || enabled[0].Name != "read_file" || enabled[1].Name != "list_files" {
+		t.Errorf("Unexpected enabled tools: %v", enabled)
+	}
+
+	// Test Case 3: Unknown names are reported
+	if err := r.Configure(nil, []string{"nope"}); err == nil {
+		t.Error("Expected error for unknown tool, got nil")
+	}
+}
+
+// TestHelperPlugin is not a real test; it is executed as an external plugin by TestPluginTool
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv("TRACE_TEST_PLUGIN") != "1" {
+		return
+	}
+	input, _ := io.ReadAll(os.Stdin)
+	var args struct {
+		Name string `json:"name"`
+	}
+	json.Unmarshal(input, &args)
+	if args.Name == "" {
+		fmt.Print(`{"error": "name is required"}`)
+	} else {
+		fmt.Printf(`{"output": "hello %s"}`, args.Name)
+	}
+	os.Exit(0)
+}
+
+func TestPluginTool(t *testing.T) {
+	t.Setenv("TRACE_TEST_PLUGIN", "1")
+
+	def, err := NewPluginTool(config.Plugin{
+		Name:        "greet",
+		Description: "Greets someone",
+		Command:     os.Args[0],
+		Args:        []string{"-test.run=TestHelperPlugin"},
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"name":{"type":"string","description":"Who to greet"}},"required":["name"]}`),
+	})
+	if err != nil {
+		t.Fatalf("NewPluginTool failed: %v", err)
+	}
+
+	// Schema is loaded from the declaration
+	if prop, ok := def.Parameters.Properties.Get("name"); !ok || prop.Description != "Who to greet" {
+		t.Errorf("Schema not loaded from declaration: %+v", def.Parameters)
+	}
+
+	result, err := def.Function(json.RawMessage(`{"name":"trace"}`))
+	if err != nil {
+		t.Fatalf("Plugin failed: %v", err)
+	}
+	if result.Content != "hello trace" || result.IsError {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	// Errors reported by the plugin surface as tool errors
+	if _, err := def.Function(json.RawMessage(`{}`)); err == nil || err.Error() != "name is required" {
+		t.Errorf("Expected plugin error, got %v", err)
+	}
+
+	// Plugins can't replace built-in tools
+	if _, err := NewPluginTool(config.Plugin{Name: "read_file", Command: "cat"}); err == nil || !strings.Contains(err.Error(), "existing tool") {
+		t.Errorf("Expected a plugin named read_file to be rejected, got %v", err)
+	}
+}
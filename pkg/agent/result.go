@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ToolResult is the structured outcome of a tool call
+type ToolResult struct {
+	Content  string         `json:"content"`
+	IsError  bool           `json:"is_error,omitempty"`
+	ExitCode int            `json:"exit_code,omitempty"` // Process exit status for command tools
+	Metadata map[string]any `json:"metadata,omitempty"`  // Structured details for the UI (paths, sizes, ...), not sent to the model
+}
+
+// ErrorResult wraps a tool failure so it can be reported to the model and the UI
+func ErrorResult(err error) ToolResult {
+	return ToolResult{Content: err.Error(), IsError: true}
+}
+
+// ForModel renders the result as tool message content. Chat completion APIs have no
+// error flag on tool messages, so failures are spelled out in the text instead.
+func (r ToolResult) ForModel() string {
+	if !r.IsError {
+		return r.Content
+	}
+	if r.ExitCode != 0 {
+		return fmt.Sprintf("Error: command exited with code %d\nOutput:\n%s", r.ExitCode, r.Content)
+	}
+	return "Error executing tool: " + r.Content
+}
+
+// Summary returns the first line of the content, for compact display
+func (r ToolResult) Summary() string {
+	line, _, _ := strings.Cut(strings.TrimSpace(r.Content), "\n")
+	return line
+}
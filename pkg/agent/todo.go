@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// --- Todo Write ---
+
+type TodoWriteInput struct {
+	Todos []PlanItem `json:"todos" jsonschema_description:"The complete todo list. Replaces the previous list, so include every item each time."`
+}
+
+var TodoWriteDefinition = ToolDefinition{
+	Name:        "todo_write",
+	Description: "Create or update the todo list shown to the user for multi-step tasks. Keep exactly one item in_progress while working and mark items done as soon as they are finished.",
+	Parameters:  GenerateSchema[TodoWriteInput](),
+	Function:    TodoWrite,
+	UIOnly:      true,
+}
+
+// TodoWrite only validates input; the todo list lives in the TUI
+func TodoWrite(input json.RawMessage) (ToolResult, error) {
+	if _, err := ParseTodoWrite(input); err != nil {
+		return ToolResult{}, err
+	}
+	return ToolResult{}, fmt.Errorf("todo_write must be run by the Trace TUI")
+}
+
+// ParseTodoWrite decodes and validates todo_write arguments
+func ParseTodoWrite(input json.RawMessage) (TodoWriteInput, error) {
+	var args TodoWriteInput
+	if err := json.Unmarshal(input, &args); err != nil {
+		return args, err
+	}
+	for i, item := range args.Todos {
+		if item.Text == "" {
+			return args, fmt.Errorf("todo %d has no text", i+1)
+		}
+		if item.Status == "" {
+			args.Todos[i].Status = StatusPending
+		} else if !validStatus(item.Status) {
+			return args, fmt.Errorf("todo %d has invalid status: %s", i+1, item.Status)
+		}
+	}
+	return args, nil
+}
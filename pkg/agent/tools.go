@@ -2,8 +2,10 @@ package agent
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -11,6 +13,8 @@ import (
 	"strings"
 	"unicode/utf8"
 
+	"github.com/bethel-nz/trace/pkg/config"
+
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/lipgloss/tree"
 	"github.com/invopop/jsonschema"
@@ -20,7 +24,9 @@ type ToolDefinition struct {
 	Name        string            `json:"name"`
 	Description string            `json:"description"`
 	Parameters  jsonschema.Schema `json:"parameters"`
-	Function    func(input json.RawMessage) (string, error)
+	Function    func(input json.RawMessage) (ToolResult, error)
+	UIOnly      bool `json:"-"` // Only meaningful inside the TUI (e.g. window control); hidden from headless callers
+	ReadOnly    bool `json:"-"` // Never modifies files or runs commands; safe for exploration-only agents
 }
 
 func GenerateSchema[T any]() jsonschema.Schema {
@@ -33,31 +39,41 @@ func GenerateSchema[T any]() jsonschema.Schema {
 	return *schema
 }
 
-// GetAllToolDefinitions returns all available tool definitions
+func init() {
+	Register(ReadFileDefinition)
+	Register(ListFilesDefinition)
+	Register(RunCommandDefinition)
+	Register(InitProjectDefinition)
+	Register(WriteFileDefinition)
+	Register(EditFileDefinition)
+	Register(ApplyPatchDefinition)
+	Register(MoveFileDefinition)
+	Register(DeleteFileDefinition)
+	Register(MakeDirDefinition)
+	Register(FileInfoDefinition)
+	Register(ManageWindowDefinition)
+	Register(RememberDefinition)
+	Register(DelegateTaskDefinition)
+	Register(UpdatePlanDefinition)
+	Register(TodoWriteDefinition)
+}
+
+// GetAllToolDefinitions returns all enabled tool definitions
 func GetAllToolDefinitions() []ToolDefinition {
-	return []ToolDefinition{
-		ReadFileDefinition,
-		ListFilesDefinition,
-		RunCommandDefinition,
-		InitProjectDefinition,
-		WriteFileDefinition,
-		EditFileDefinition,
-		ManageWindowDefinition,
-	}
+	return DefaultRegistry.Enabled()
 }
 
-// ExecuteToolByName executes a tool by name with JSON arguments
-func ExecuteToolByName(name string, argsJSON json.RawMessage) (string, error) {
-	for _, tool := range GetAllToolDefinitions() {
-		if tool.Name == name {
-			return tool.Function(argsJSON)
-		}
-	}
-	return "", fmt.Errorf("unknown tool: %s", name)
+// ExecuteToolByName executes a tool by name with JSON arguments.
+// Failures are reported in the result (IsError) rather than as a Go error.
+func ExecuteToolByName(name string, argsJSON json.RawMessage) ToolResult {
+	return DefaultRegistry.Execute(name, argsJSON)
 }
 
 // --- Read File ---
 
+// read_file refuses files larger than this
+const maxReadSize = 100 * 1024
+
 type ReadFileInput struct {
 	Path string `json:"path" jsonschema_description:"The relative path of a file in the working directory."`
 }
@@ -67,41 +83,49 @@ var ReadFileDefinition = ToolDefinition{
 	Description: "Read the contents of a given relative file path.",
 	Parameters:  GenerateSchema[ReadFileInput](),
 	Function:    ReadFile,
+	ReadOnly:    true,
 }
 
-func ReadFile(input json.RawMessage) (string, error) {
+func ReadFile(input json.RawMessage) (ToolResult, error) {
 	var args ReadFileInput
 	if err := json.Unmarshal(input, &args); err != nil {
-		return "", err
+		return ToolResult{}, err
 	}
 
 	// 0. Security: explicitly block .env
 	if strings.HasSuffix(args.Path, ".env") {
-		return "", fmt.Errorf("access denied: .env files are protected")
+		return ToolResult{}, fmt.Errorf("access denied: .env files are protected")
 	}
 
 	// 1. Check size (Limit to 100KB)
 	info, err := os.Stat(args.Path)
 	if err != nil {
-		return "", err
+		return ToolResult{}, err
 	}
-	if info.Size() > 100*1024 {
-		return "", fmt.Errorf("skipped: file too large (>100KB)")
+	if info.Size() > maxReadSize {
+		return ToolResult{}, fmt.Errorf("skipped: file too large (>100KB)")
 	}
 
 	// 2. Read
 	content, err := os.ReadFile(args.Path)
 	if err != nil {
-		return "", err
+		return ToolResult{}, err
 	}
 
 	// 3. Check for binary junk
 	if !utf8.Valid(content) {
-		return "", fmt.Errorf("skipped: appears to be binary")
+		return ToolResult{}, fmt.Errorf("skipped: appears to be binary")
 	}
 
+	// Writes check the file has not changed on disk since this read
+	recordVersion(args.Path, content)
+
 	// 4. Return with Metadata
-	return fmt.Sprintf("File: %s\nSize: %d bytes\nLines: %d\n\n%s", args.Path, len(content), strings.Count(string(content), "\n")+1, string(content)), nil
+	lines := strings.Count(string(content), "\n") + 1
+	return ToolResult{
+		Content:  fmt.Sprintf("File: %s\nSize: %d bytes\nLines: %d\n\n%s", args.Path, len(content), lines, string(content)),
+		Metadata: map[string]any{"path": args.Path, "bytes": len(content), "lines": lines},
+	}, nil
 }
 
 // --- List Files ---
@@ -115,12 +139,13 @@ var ListFilesDefinition = ToolDefinition{
 	Description: "List files in the project. Respects .gitignore.",
 	Parameters:  GenerateSchema[ListFilesInput](),
 	Function:    ListFiles,
+	ReadOnly:    true,
 }
 
-func ListFiles(input json.RawMessage) (string, error) {
+func ListFiles(input json.RawMessage) (ToolResult, error) {
 	var args ListFilesInput
 	if err := json.Unmarshal(input, &args); err != nil {
-		return "", err
+		return ToolResult{}, err
 	}
 
 	dir := "."
@@ -154,7 +179,7 @@ func ListFiles(input json.RawMessage) (string, error) {
 			return nil
 		})
 		if err != nil {
-			return "", err
+			return ToolResult{}, err
 		}
 	}
 
@@ -169,6 +194,7 @@ func ListFiles(input json.RawMessage) (string, error) {
 		// 3. EXTRA SAFETY: Skip .git, bin, agent binaries, and .env
 		// This applies to both git output and fallback output
 		if strings.HasPrefix(path, ".git/") ||
+			strings.HasPrefix(path, config.ProjectDir+"/") ||
 			strings.HasPrefix(path, "bin/") ||
 			path == "agent" ||
 			path == "trace" ||
@@ -200,7 +226,7 @@ func ListFiles(input json.RawMessage) (string, error) {
 		RootStyle(rootStyle).
 		ItemStyle(itemStyle)
 
-	return t.String(), nil
+	return ToolResult{Content: t.String()}, nil
 }
 
 // buildFileTree creates a tree structure from a list of file paths
@@ -277,24 +303,33 @@ func ResolveBinary(bin string) string {
 	return bin
 }
 
-func RunCommand(input json.RawMessage) (string, error) {
+func RunCommand(input json.RawMessage) (ToolResult, error) {
 	var args RunCommandInput
 	if err := json.Unmarshal(input, &args); err != nil {
-		return "", err
+		return ToolResult{}, err
 	}
 
 	// Smart resolve the command
 	cmdName := ResolveBinary(args.Command)
 
-	// Print for user visibility
-	fmt.Printf("[Exec] %s %v\n", cmdName, args.Args)
+	// Log for visibility; stdout belongs to the TUI (or the MCP transport)
+	slog.Info("Exec", "command", cmdName, "args", args.Args)
 
 	cmd := exec.Command(cmdName, args.Args...)
 	output, err := cmd.CombinedOutput()
+	result := ToolResult{Content: string(output), Metadata: map[string]any{"command": cmdName}}
+
+	// A non-zero exit is a failed call, but the output is still what the model needs to see
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.IsError = true
+		result.ExitCode = exitErr.ExitCode()
+		return result, nil
+	}
 	if err != nil {
-		return fmt.Sprintf("Error: %s\nOutput:\n%s", err, string(output)), nil
+		return ToolResult{}, err
 	}
-	return string(output), nil
+	return result, nil
 }
 
 // --- Init Project ---
@@ -311,17 +346,17 @@ var InitProjectDefinition = ToolDefinition{
 	Function:    InitProject,
 }
 
-func InitProject(input json.RawMessage) (string, error) {
+func InitProject(input json.RawMessage) (ToolResult, error) {
 	var args InitProjectInput
 	if err := json.Unmarshal(input, &args); err != nil {
-		return "", err
+		return ToolResult{}, err
 	}
 
 	targetDir := "."
 	if args.Name != "" {
 		targetDir = args.Name
 		if err := os.MkdirAll(targetDir, 0755); err != nil {
-			return "", fmt.Errorf("failed to create directory: %w", err)
+			return ToolResult{}, fmt.Errorf("failed to create directory: %w", err)
 		}
 	}
 
@@ -338,7 +373,7 @@ func InitProject(input json.RawMessage) (string, error) {
 	cmd := exec.Command("git", "init")
 	cmd.Dir = targetDir
 	if out, err := cmd.CombinedOutput(); err != nil {
-		return "", fmt.Errorf("git init failed: %s", string(out))
+		return ToolResult{}, fmt.Errorf("git init failed: %s", string(out))
 	}
 
 	// 2. README.md
@@ -349,10 +384,22 @@ func InitProject(input json.RawMessage) (string, error) {
 	// 3. .gitignore
 	gitignoreContent := ".DS_Store\nnode_modules/\ndist/\nbin/\n.env\n"
 	if err := writeFile(".gitignore", gitignoreContent); err != nil {
-		return "", fmt.Errorf("failed to create .gitignore: %w", err)
+		return ToolResult{}, fmt.Errorf("failed to create .gitignore: %w", err)
 	}
 
-	return fmt.Sprintf("Initialized project in '%s' with git, README.md, and .gitignore.", targetDir), nil
+	return ToolResult{Content: fmt.Sprintf("Initialized project in '%s' with git, README.md, and .gitignore.", targetDir)}, nil
+}
+
+// --- File Changes ---
+
+// BeforeWrite, when set, is called with each path a tool is about to create or change,
+// e.g. to back the file up for checkpoints
+var BeforeWrite func(path string)
+
+func beforeWrite(path string) {
+	if BeforeWrite != nil {
+		BeforeWrite(path)
+	}
 }
 
 // --- Edit File ---
@@ -370,38 +417,54 @@ var EditFileDefinition = ToolDefinition{
 	Function:    EditFile,
 }
 
-func EditFile(input json.RawMessage) (string, error) {
+func EditFile(input json.RawMessage) (ToolResult, error) {
 	var args EditFileInput
 	if err := json.Unmarshal(input, &args); err != nil {
-		return "", err
+		return ToolResult{}, err
 	}
 
-	// 0. Security: explicitly block .env
-	if strings.HasSuffix(args.Path, ".env") {
-		return "", fmt.Errorf("access denied: .env files are protected")
+	// 0. Security: block .env, .git and .trace
+	if err := checkPath(args.Path); err != nil {
+		return ToolResult{}, err
 	}
 
-	// 1. Read File
+	// 1. Read File, which the agent must have read as it is now
+	if err := checkFresh(args.Path, true); err != nil {
+		return ToolResult{}, err
+	}
 	contentBytes, err := os.ReadFile(args.Path)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file: %v", err)
+		return ToolResult{}, fmt.Errorf("failed to read file: %v", err)
 	}
-	content := string(contentBytes)
+	// Match against LF text without a BOM, as the model sees the file
+	content, format := decodeText(string(contentBytes))
+	search := strings.ReplaceAll(args.SearchText, "\r\n", "\n")
 
 	// 2. Locate the Block
-	if !strings.Contains(content, args.SearchText) {
-		return "", fmt.Errorf("search block not found in %s. Ensure exact match (including whitespace).", args.Path)
+	if !strings.Contains(content, search) {
+		return ToolResult{}, fmt.Errorf("search block not found in %s. Ensure exact match (including whitespace).", args.Path)
 	}
 
-	// 3. Replace
-	newContent := strings.Replace(content, args.SearchText, args.ReplaceText, 1)
+	// 3. Replace, restoring the file's line endings and BOM
+	newContent := format.encode(strings.Replace(content, search, strings.ReplaceAll(args.ReplaceText, "\r\n", "\n"), 1))
 
 	// 4. Write Back
-	if err := os.WriteFile(args.Path, []byte(newContent), 0644); err != nil {
-		return "", fmt.Errorf("failed to write file: %v", err)
+	beforeWrite(args.Path)
+	if err := writeAtomic(args.Path, []byte(newContent), 0644); err != nil {
+		return ToolResult{}, fmt.Errorf("failed to write file: %v", err)
+	}
+	recordVersion(args.Path, []byte(newContent))
+
+	// 5. Formatters and linters configured for the file
+	message := fmt.Sprintf("Successfully edited %s", args.Path)
+	if hooks := runPostEditHooks([]string{args.Path}); hooks != "" {
+		message += "\n\n" + hooks
 	}
 
-	return fmt.Sprintf("Successfully edited %s", args.Path), nil
+	return ToolResult{
+		Content:  message,
+		Metadata: map[string]any{"path": args.Path},
+	}, nil
 }
 
 // --- Write File ---
@@ -419,54 +482,112 @@ var WriteFileDefinition = ToolDefinition{
 	Function:    WriteFile,
 }
 
-func WriteFile(input json.RawMessage) (string, error) {
+func WriteFile(input json.RawMessage) (ToolResult, error) {
 	var args WriteFileInput
 	if err := json.Unmarshal(input, &args); err != nil {
-		return "", err
+		return ToolResult{}, err
 	}
 
-	// 0. Security: explicitly block .env
-	if strings.HasSuffix(args.Path, ".env") {
-		return "", fmt.Errorf("access denied: .env files are protected")
+	// 0. Security: block .env, .git and .trace
+	if err := checkPath(args.Path); err != nil {
+		return ToolResult{}, err
+	}
+
+	// 1. Overwrite only files read as they are now, keeping their line endings, BOM and final newline
+	if err := checkFresh(args.Path, true); err != nil {
+		return ToolResult{}, err
+	}
+	content := args.Content
+	if old, err := os.ReadFile(args.Path); err == nil {
+		content = conform(string(old), content)
 	}
 
-	// 1. Create directory if needed
+	// 2. Create directory if needed
 	dir := filepath.Dir(args.Path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create directory: %v", err)
+		return ToolResult{}, fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	// 3. Write File
+	beforeWrite(args.Path)
+	if err := writeAtomic(args.Path, []byte(content), 0644); err != nil {
+		return ToolResult{}, fmt.Errorf("failed to write file: %v", err)
 	}
+	recordVersion(args.Path, []byte(content))
 
-	// 2. Write File
-	if err := os.WriteFile(args.Path, []byte(args.Content), 0644); err != nil {
-		return "", fmt.Errorf("failed to write file: %v", err)
+	// 4. Formatters and linters configured for the file
+	message := fmt.Sprintf("Successfully wrote to %s (Length: %d characters)", args.Path, len(args.Content))
+	if hooks := runPostEditHooks([]string{args.Path}); hooks != "" {
+		message += "\n\n" + hooks
 	}
 
-	return fmt.Sprintf("Successfully wrote to %s (Length: %d characters)", args.Path, len(args.Content)), nil
+	return ToolResult{
+		Content:  message,
+		Metadata: map[string]any{"path": args.Path, "bytes": len(args.Content)},
+	}, nil
 }
 
 // --- Manage Window ---
 
+// Sidebar tabs that manage_window can open
+const (
+	WindowTerminal = "terminal"
+	WindowFile     = "file"
+	WindowDiff     = "diff"
+	WindowTodos    = "todos"
+	WindowGit      = "git"
+)
+
 type ManageWindowInput struct {
-	Action string `json:"action" jsonschema_description:"Action to perform: 'open' or 'close'."`
-	Target string `json:"target,omitempty" jsonschema_description:"Target view: 'terminal' (default)."`
+	Action string `json:"action" jsonschema:"enum=open,enum=focus,enum=close" jsonschema_description:"'open' shows a tab (creating it if needed), 'focus' switches to an existing tab, 'close' closes a tab, or the whole sidebar when no target or tab is given."`
+	Target string `json:"target,omitempty" jsonschema:"enum=terminal,enum=file,enum=diff,enum=todos,enum=git" jsonschema_description:"Kind of tab: 'terminal' (command output, default for open), 'file' (a syntax-highlighted file), 'diff' (uncommitted git changes), 'todos' (the todo list) or 'git' (git status)."`
+	Path   string `json:"path,omitempty" jsonschema_description:"File to show. Required to open a 'file' tab; optional for 'diff' to limit it to one path."`
+	Line   int    `json:"line,omitempty" jsonschema_description:"Optional 1-based line to scroll to and highlight in a 'file' tab."`
+	Tab    string `json:"tab,omitempty" jsonschema_description:"Name of an existing tab, as shown in the tab bar, to focus or close."`
 }
 
 var ManageWindowDefinition = ToolDefinition{
 	Name:        "manage_window",
-	Description: "Control the interface layout, such as opening or closing the sidebar to show terminal output.",
+	Description: "Control the sidebar: open, focus or close tabs showing terminal output, a file, a git diff, the todo list or git status, or close the sidebar entirely, so the user can follow along.",
 	Parameters:  GenerateSchema[ManageWindowInput](),
 	Function:    ManageWindow,
+	UIOnly:      true,
 }
 
-func ManageWindow(input json.RawMessage) (string, error) {
+// ManageWindow only validates input; the sidebar lives in the TUI
+func ManageWindow(input json.RawMessage) (ToolResult, error) {
+	args, err := ParseManageWindow(input)
+	if err != nil {
+		return ToolResult{}, err
+	}
+	return ToolResult{Content: fmt.Sprintf("Window action '%s' triggered for target '%s'", args.Action, args.Target)}, nil
+}
+
+// ParseManageWindow decodes and validates manage_window arguments
+func ParseManageWindow(input json.RawMessage) (ManageWindowInput, error) {
 	var args ManageWindowInput
 	if err := json.Unmarshal(input, &args); err != nil {
-		return "", err
+		return args, err
+	}
+	switch args.Action {
+	case "open", "focus", "close":
+	default:
+		return args, fmt.Errorf("invalid action: %s", args.Action)
+	}
+	switch args.Target {
+	case "", WindowTerminal, WindowDiff, WindowTodos, WindowGit:
+	case WindowFile:
+		if args.Path == "" && args.Tab == "" {
+			return args, fmt.Errorf("path is required for a file tab")
+		}
+	default:
+		return args, fmt.Errorf("invalid target: %s", args.Target)
 	}
-
-	if args.Action != "open" && args.Action != "close" {
-		return "", fmt.Errorf("invalid action: %s", args.Action)
+	if args.Action == "focus" && args.Target == "" && args.Tab == "" {
+		return args, fmt.Errorf("focus needs a target or tab")
 	}
-
-	return fmt.Sprintf("Window action '%s' triggered for target '%s'", args.Action, args.Target), nil
+	if strings.HasSuffix(args.Path, ".env") {
+		return args, fmt.Errorf("access denied: .env files are protected")
+	}
+	return args, nil
 }
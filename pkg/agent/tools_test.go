@@ -8,8 +8,10 @@ import (
 )
 
 func TestEditFile(t *testing.T) {
-	// Setup
-	tmpFile, err := os.CreateTemp("", "test_edit_file_*.txt")
+	// Setup: tools only change files inside the project
+	dir := t.TempDir()
+	t.Chdir(dir)
+	tmpFile, err := os.CreateTemp(dir, "test_edit_file_*.txt")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -20,20 +22,35 @@ func TestEditFile(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// Test Case 1: Successful Edit
+	// Test Case 1: Editing a file that was never read is refused
 	args := EditFileInput{
 		Path:        tmpFile.Name(),
 		SearchText:  "Line 2\n",
 		ReplaceText: "Line 2 Modified\n",
 	}
 	argsBytes, _ := json.Marshal(args)
+	if _, err := EditFile(argsBytes); err == nil || !strings.Contains(err.Error(), "not been read") {
+		t.Fatalf("Expected an unread file to be refused, got %v", err)
+	}
+
+	// Test Case 2: Successful Edit after reading
+	readBytes, _ := json.Marshal(ReadFileInput{Path: tmpFile.Name()})
+	if _, err := ReadFile(readBytes); err != nil {
+		t.Fatal(err)
+	}
+	args = EditFileInput{
+		Path:        tmpFile.Name(),
+		SearchText:  "Line 2\n",
+		ReplaceText: "Line 2 Modified\n",
+	}
+	argsBytes, _ = json.Marshal(args)
 
 	result, err := EditFile(argsBytes)
 	if err != nil {
 		t.Fatalf("EditFile failed: %v", err)
 	}
-	if !strings.Contains(result, "Successfully edited") {
-		t.Errorf("Unexpected result: %s", result)
+	if !strings.Contains(result.Content, "Successfully edited") {
+		t.Errorf("Unexpected result: %s", result.Content)
 	}
 
 	// Verify Content
@@ -43,7 +60,7 @@ func TestEditFile(t *testing.T) {
 		t.Errorf("Expected content:\n%q\nGot:\n%q", expected, string(content))
 	}
 
-	// Test Case 2: Block Not Found
+	// Test Case 3: Block Not Found
 	args.SearchText = "NonExistent"
 	argsBytes, _ = json.Marshal(args)
 	_, err = EditFile(argsBytes)
@@ -51,3 +68,39 @@ func TestEditFile(t *testing.T) {
 		t.Error("Expected error for non-existent block, got nil")
 	}
 }
+
+func TestRunCommandExitCode(t *testing.T) {
+	args, _ := json.Marshal(RunCommandInput{Command: "sh", Args: []string{"-c", "echo partial; exit 3"}})
+	result, err := RunCommand(args)
+	if err != nil {
+		t.Fatalf("RunCommand failed: %v", err)
+	}
+	if !result.IsError || result.ExitCode != 3 || !strings.Contains(result.Content, "partial") {
+		t.Errorf("Expected failed result with exit code 3 and output, got %+v", result)
+	}
+	if model := result.ForModel(); !strings.Contains(model, "exited with code 3") || !strings.Contains(model, "partial") {
+		t.Errorf("Unexpected model content: %q", model)
+	}
+
+	// Unknown tools come back as error results rather than Go errors
+	if result := ExecuteToolByName("no_such_tool", json.RawMessage(`{}`)); !result.IsError {
+		t.Errorf("Expected error result for unknown tool, got %+v", result)
+	}
+}
+
+func TestParseManageWindow(t *testing.T) {
+	if args, err := ParseManageWindow(json.RawMessage(`{"action":"close"}`)); err != nil || args.Target != "" {
+		t.Errorf("Expected a bare close to be valid, got %+v, %v", args, err)
+	}
+	for _, input := range []string{
+		`{"action":"open","target":"file"}`,
+		`{"action":"open","target":"file","path":".env"}`,
+		`{"action":"open","target":"browser"}`,
+		`{"action":"focus"}`,
+		`{"action":"toggle"}`,
+	} {
+		if _, err := ParseManageWindow(json.RawMessage(input)); err == nil {
+			t.Errorf("Expected error for %s", input)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// --- Safe Writes ---
+
+// fileVersion is a file as the agent last saw it, through read_file or its own write
+type fileVersion struct {
+	SeenAt time.Time
+	Hash   [sha256.Size]byte
+}
+
+// seenFiles holds the version of each file the agent has seen this session, by absolute path
+var seenFiles = struct {
+	sync.Mutex
+	files map[string]fileVersion
+}{files: make(map[string]fileVersion)}
+
+func seenKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// recordVersion remembers content as the agent's view of the file, after it read or wrote it
+func recordVersion(path string, content []byte) {
+	seenFiles.Lock()
+	defer seenFiles.Unlock()
+	seenFiles.files[seenKey(path)] = fileVersion{SeenAt: time.Now(), Hash: sha256.Sum256(content)}
+}
+
+// forgetVersion drops what the agent saw of path, or everything under it, once it is deleted or moved
+func forgetVersion(path string) {
+	key := seenKey(path)
+	seenFiles.Lock()
+	defer seenFiles.Unlock()
+	for seen := range seenFiles.files {
+		if seen == key || strings.HasPrefix(seen, key+string(filepath.Separator)) {
+			delete(seenFiles.files, seen)
+		}
+	}
+}
+
+// checkFresh fails when an existing file changed on disk since the agent last saw it, e.g.
+// because the user edited it meanwhile. With mustRead it also fails for existing files the
+// agent has not read this session, so changes are never based on guessed contents.
+// Files too large for read_file are exempt from that.
+func checkFresh(path string, mustRead bool) error {
+	seenFiles.Lock()
+	seen, ok := seenFiles.files[seenKey(path)]
+	seenFiles.Unlock()
+
+	content, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err) && ok:
+		return fmt.Errorf("%s was deleted since it was read at %s", path, seen.SeenAt.Format("15:04:05"))
+	case os.IsNotExist(err):
+		return nil // A new file
+	case err != nil:
+		return err
+	case !ok && mustRead && len(content) <= maxReadSize: // Larger files can't be read with read_file
+		return fmt.Errorf("%s has not been read in this session; read it with read_file first so the change is based on its current contents", path)
+	case ok && sha256.Sum256(content) != seen.Hash:
+		return fmt.Errorf("%s was modified on disk since it was read at %s; read it again before changing it", path, seen.SeenAt.Format("15:04:05"))
+	}
+	return nil
+}
+
+// writeAtomic replaces path with data through a temporary file and a rename, so an
+// interrupted write never leaves a truncated file. An existing file keeps its mode and
+// owner, and a symlink keeps pointing at its target; perm is used for new files.
+func writeAtomic(path string, data []byte, perm os.FileMode) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	info, statErr := os.Stat(path)
+	if statErr == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if statErr == nil {
+		preserveOwner(tmp.Name(), info)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// --- Text Conventions ---
+
+const utf8BOM = "\uFEFF"
+
+// textFormat records the line ending, byte order mark and final newline of a text file
+type textFormat struct {
+	BOM          bool
+	CRLF         bool
+	FinalNewline bool
+}
+
+// decodeText strips the BOM and converts CRLF to LF so text can be edited as the model
+// sees it. Files that are not UTF-8 are returned unchanged.
+func decodeText(content string) (string, textFormat) {
+	var f textFormat
+	if !utf8.ValidString(content) {
+		return content, f
+	}
+	content, f.BOM = strings.CutPrefix(content, utf8BOM)
+	// A file counts as CRLF when most of its lines are
+	if crlf := strings.Count(content, "\r\n"); crlf > 0 && crlf*2 >= strings.Count(content, "\n") {
+		f.CRLF = true
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+	}
+	f.FinalNewline = strings.HasSuffix(content, "\n")
+	return content, f
+}
+
+// encode converts LF text back to the file's line endings and BOM
+func (f textFormat) encode(content string) string {
+	if f.CRLF {
+		content = strings.ReplaceAll(strings.ReplaceAll(content, "\r\n", "\n"), "\n", "\r\n")
+	}
+	if f.BOM && !strings.HasPrefix(content, utf8BOM) {
+		content = utf8BOM + content
+	}
+	return content
+}
+
+// conform makes new content for an existing file follow its conventions: BOM, line
+// endings and whether it ends with a newline
+func conform(old, content string) string {
+	if !utf8.ValidString(old) || old == "" {
+		return content
+	}
+	_, f := decodeText(old)
+	content = strings.ReplaceAll(strings.TrimPrefix(content, utf8BOM), "\r\n", "\n")
+	if content != "" {
+		if f.FinalNewline && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		} else if !f.FinalNewline {
+			content = strings.TrimRight(content, "\n")
+		}
+	}
+	return f.encode(content)
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileKeepsConventions(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("run.sh", []byte("#!/bin/sh\necho hi\n"), 0755)
+	os.WriteFile("win.txt", []byte(utf8BOM+"one\r\ntwo\r\n"), 0644)
+	os.WriteFile("bare.txt", []byte("no newline"), 0644)
+
+	writes := map[string]string{
+		"run.sh":   "#!/bin/sh\necho bye", // The final newline is restored
+		"win.txt":  "one\ntwo\nthree\n",
+		"bare.txt": "still none\n",
+	}
+	for path, content := range writes {
+		callTool(t, ReadFile, ReadFileInput{Path: path})
+		if _, err := callTool(t, WriteFile, WriteFileInput{Path: path, Content: content}); err != nil {
+			t.Fatalf("WriteFile %s failed: %v", path, err)
+		}
+	}
+	expectContent(t, "run.sh", "#!/bin/sh\necho bye\n")
+	expectContent(t, "win.txt", utf8BOM+"one\r\ntwo\r\nthree\r\n")
+	expectContent(t, "bare.txt", "still none")
+	if info, _ := os.Stat("run.sh"); info.Mode().Perm() != 0755 {
+		t.Errorf("Expected run.sh to stay executable, got %v", info.Mode())
+	}
+	if leftovers, _ := filepath.Glob(".*.tmp"); len(leftovers) > 0 {
+		t.Errorf("Expected no temporary files left, got %v", leftovers)
+	}
+}
+
+func TestEditFileCRLFAndSymlink(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("target.txt", []byte("a\r\nb\r\nc\r\n"), 0600)
+	os.Symlink("target.txt", "link.txt")
+
+	callTool(t, ReadFile, ReadFileInput{Path: "link.txt"})
+	if _, err := callTool(t, EditFile, EditFileInput{Path: "link.txt", SearchText: "a\nb\n", ReplaceText: "a\nB\n"}); err != nil {
+		t.Fatalf("EditFile failed: %v", err)
+	}
+	expectContent(t, "target.txt", "a\r\nB\r\nc\r\n")
+	if info, err := os.Lstat("link.txt"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected link.txt to remain a symlink")
+	}
+	if info, _ := os.Stat("target.txt"); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the mode kept, got %v", info.Mode())
+	}
+}
+
+func TestWriteRequiresFreshRead(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("a.txt", []byte("one\n"), 0644)
+	if _, err := callTool(t, WriteFile, WriteFileInput{Path: "a.txt", Content: "two\n"}); err == nil || !strings.Contains(err.Error(), "not been read") {
+		t.Fatalf("Expected overwriting an unread file refused, got %v", err)
+	}
+	if _, err := callTool(t, ReadFile, ReadFileInput{Path: "a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The user edits the file after the agent read it, keeping its size
+	os.WriteFile("a.txt", []byte("ONE\n"), 0644)
+	_, err := callTool(t, EditFile, EditFileInput{Path: "a.txt", SearchText: "one", ReplaceText: "two"})
+	if err == nil || !strings.Contains(err.Error(), "modified on disk") {
+		t.Fatalf("Expected the edit refused, got %v", err)
+	}
+	if _, err := callTool(t, WriteFile, WriteFileInput{Path: "a.txt", Content: "two\n"}); err == nil {
+		t.Fatal("Expected the write refused")
+	}
+
+	// Reading it again allows the change
+	callTool(t, ReadFile, ReadFileInput{Path: "a.txt"})
+	if _, err := callTool(t, EditFile, EditFileInput{Path: "a.txt", SearchText: "ONE", ReplaceText: "two"}); err != nil {
+		t.Fatalf("EditFile after re-reading failed: %v", err)
+	}
+	// The agent's own edit does not count as an external change
+	if _, err := callTool(t, EditFile, EditFileInput{Path: "a.txt", SearchText: "two", ReplaceText: "three"}); err != nil {
+		t.Fatalf("Second EditFile failed: %v", err)
+	}
+	expectContent(t, "a.txt", "three\n")
+
+	// New files need no read, and deleting a file forgets it
+	if _, err := callTool(t, WriteFile, WriteFileInput{Path: "b.txt", Content: "new\n"}); err != nil {
+		t.Fatalf("Writing a new file failed: %v", err)
+	}
+	callTool(t, DeleteFile, DeleteFileInput{Path: "b.txt"})
+	if _, err := callTool(t, WriteFile, WriteFileInput{Path: "b.txt", Content: "again\n"}); err != nil {
+		t.Fatalf("Recreating a deleted file failed: %v", err)
+	}
+
+	// A refused write leaves no trace, not even its directory
+	os.MkdirAll("sub", 0755)
+	os.WriteFile("sub/c.txt", []byte("c\n"), 0644)
+	callTool(t, ReadFile, ReadFileInput{Path: "sub/c.txt"})
+	os.RemoveAll("sub")
+	if _, err := callTool(t, WriteFile, WriteFileInput{Path: "sub/c.txt", Content: "c2\n"}); err == nil {
+		t.Fatal("Expected writing a file deleted since it was read refused")
+	}
+	if _, err := os.Stat("sub"); !os.IsNotExist(err) {
+		t.Errorf("Expected no directory created by a refused write, got %v", err)
+	}
+}
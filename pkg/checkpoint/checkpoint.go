@@ -0,0 +1,363 @@
+// Package checkpoint snapshots the working tree at the start of each user turn so
+// the files can be restored later.
+//
+// Inside a git repository a snapshot is a commit of the whole working tree (tracked
+// and untracked, minus ignored files) built with a temporary index and kept alive by a
+// private ref under refs/trace/. The user's index, branches and stash are untouched.
+// Outside git there is nothing to snapshot cheaply, so files are copied the first time
+// a tool is about to change them in each turn.
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bethel-nz/trace/pkg/config"
+)
+
+// Git refs holding snapshots live under this prefix, then the session and checkpoint ID
+const refPrefix = "refs/trace/checkpoints/"
+
+// Snapshot commits are authored by Trace, whatever the user's git identity
+var gitIdentity = []string{
+	"GIT_AUTHOR_NAME=Trace", "GIT_AUTHOR_EMAIL=trace@localhost",
+	"GIT_COMMITTER_NAME=Trace", "GIT_COMMITTER_EMAIL=trace@localhost",
+}
+
+// Checkpoint is the state of the working tree at the start of a turn
+type Checkpoint struct {
+	ID      int    // 1-based, in creation order
+	Label   string // The user message that started the turn
+	Created time.Time
+	Commit  string // Snapshot commit, empty outside git
+}
+
+// Store creates and restores the checkpoints of one session
+type Store struct {
+	mu      sync.Mutex
+	root    string // Repository root, or the directory files are tracked from outside git
+	git     bool
+	gitDir  string // The repository's common git directory, which outlives a worktree
+	session string // Names the refs or backup directory of this session
+	list    []Checkpoint
+	tracked map[string]bool // Files backed up since the latest checkpoint (outside git)
+}
+
+// manifest lists the files backed up for a checkpoint outside git.
+// A file that did not exist yet maps to false and is deleted on restore.
+type manifest map[string]bool
+
+// NewStore returns a store for the repository containing dir, or for dir itself outside git
+func NewStore(dir string) *Store {
+	s := &Store{root: dir, session: time.Now().Format("20060102-150405"), tracked: make(map[string]bool)}
+	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+	cmd.Dir = dir
+	if out, err := cmd.Output(); err == nil {
+		s.root = strings.TrimSpace(string(out))
+		s.git = true
+		if common, err := s.run(nil, "rev-parse", "--path-format=absolute", "--git-common-dir"); err == nil {
+			s.gitDir = common
+		}
+	}
+	if abs, err := filepath.Abs(s.root); err == nil {
+		s.root = abs
+	}
+	return s
+}
+
+// List returns the checkpoints, oldest first
+func (s *Store) List() []Checkpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Checkpoint(nil), s.list...)
+}
+
+// Create takes a checkpoint of the working tree
+func (s *Store) Create(label string) (Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := Checkpoint{ID: len(s.list) + 1, Label: label, Created: time.Now()}
+	if s.git {
+		commit, err := s.snapshot("trace checkpoint: " + label)
+		if err != nil {
+			return cp, err
+		}
+		if _, err := s.run(nil, "update-ref", s.ref(cp.ID), commit); err != nil {
+			return cp, err
+		}
+		cp.Commit = commit
+	} else {
+		s.tracked = make(map[string]bool)
+	}
+	s.list = append(s.list, cp)
+	return cp, nil
+}
+
+// Track backs up a file before a tool changes it, once per checkpoint.
+// It does nothing in git, where the snapshot already has every file.
+func (s *Store) Track(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.git || len(s.list) == 0 {
+		return
+	}
+	rel, err := s.rel(path)
+	if err != nil || s.tracked[rel] {
+		return
+	}
+	s.tracked[rel] = true
+
+	dir := s.backupDir(len(s.list))
+	files, _ := readManifest(dir)
+	_, statErr := os.Stat(filepath.Join(s.root, rel))
+	files[rel] = statErr == nil
+	if files[rel] {
+		if err := copyFile(filepath.Join(s.root, rel), filepath.Join(dir, "files", rel)); err != nil {
+			delete(files, rel)
+		}
+	}
+	writeManifest(dir, files)
+}
+
+// Restore puts the files back as they were when checkpoint id was taken.
+// Checkpoints from id on are dropped, since they describe a future that no longer exists.
+func (s *Store) Restore(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > len(s.list) {
+		return fmt.Errorf("no checkpoint %d", id)
+	}
+
+	var err error
+	if s.git {
+		err = s.restoreGit(s.list[id-1].Commit)
+		for _, cp := range s.list[id-1:] {
+			s.run(nil, "update-ref", "-d", s.ref(cp.ID))
+		}
+	} else {
+		// Latest first, so each file ends up as it was before the first turn that touched it
+		for i := len(s.list); i >= id && err == nil; i-- {
+			err = s.restoreBackup(s.backupDir(i))
+		}
+		for i := id; i <= len(s.list) && err == nil; i++ {
+			os.RemoveAll(s.backupDir(i))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	s.list = s.list[:id-1]
+	s.tracked = make(map[string]bool)
+	return nil
+}
+
+// Close drops the session's checkpoints once it ends: the snapshot refs in git, the
+// file backups outside it. The refs are deleted through the repository's git directory,
+// so this still works after a session worktree has been removed.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if s.git {
+		for _, cp := range s.list {
+			cmd := exec.Command("git", "--git-dir", s.gitDir, "update-ref", "-d", s.ref(cp.ID))
+			if out, runErr := cmd.CombinedOutput(); runErr != nil && err == nil {
+				err = fmt.Errorf("git update-ref failed: %s", strings.TrimSpace(string(out)))
+			}
+		}
+	} else {
+		dir := filepath.Join(s.root, config.ProjectDir, "checkpoints")
+		err = os.RemoveAll(filepath.Join(dir, s.session))
+		os.Remove(dir) // Only when no other session's backups are left
+	}
+	s.list = nil
+	s.tracked = make(map[string]bool)
+	return err
+}
+
+// --- Git snapshots ---
+
+func (s *Store) ref(id int) string {
+	return fmt.Sprintf("%s%s/%d", refPrefix, s.session, id)
+}
+
+// snapshot commits the working tree through a temporary index and returns the commit
+func (s *Store) snapshot(message string) (string, error) {
+	tmp, err := os.MkdirTemp("", "trace-checkpoint-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	index := filepath.Join(tmp, "index")
+	env := append([]string{"GIT_INDEX_FILE=" + index}, gitIdentity...)
+
+	// Starting from a copy of the real index lets git skip hashing unchanged files. The copy
+	// keeps the index's mtime, which git compares with file mtimes to catch racy changes.
+	if real, err := s.run(nil, "rev-parse", "--git-path", "index"); err == nil {
+		if !filepath.IsAbs(real) {
+			real = filepath.Join(s.root, real)
+		}
+		if info, err := os.Stat(real); err == nil && copyFile(real, index) == nil {
+			os.Chtimes(index, info.ModTime(), info.ModTime())
+		}
+	}
+	if _, err := s.run(env, "add", "-A", "--", ".", ":(exclude)"+config.ProjectDir); err != nil {
+		return "", err
+	}
+	tree, err := s.run(env, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	args := []string{"commit-tree", tree, "-m", message}
+	if head, err := s.run(nil, "rev-parse", "--verify", "-q", "HEAD"); err == nil {
+		args = append(args, "-p", head)
+	}
+	return s.run(env, args...)
+}
+
+// restoreGit writes the files changed since a snapshot back to the working tree and
+// removes files created since. Unchanged files are not touched, so their mtimes survive.
+func (s *Store) restoreGit(commit string) error {
+	now, err := s.snapshot("trace checkpoint: before rewind")
+	if err != nil {
+		return err
+	}
+	added, err := s.run(nil, "diff", "--name-only", "-z", "--no-renames", "--diff-filter=A", commit, now)
+	if err != nil {
+		return err
+	}
+	for _, path := range strings.Split(added, "\x00") {
+		if path != "" {
+			os.Remove(filepath.Join(s.root, path))
+		}
+	}
+
+	// Modified, deleted and retyped files
+	changed, err := s.run(nil, "diff", "--name-only", "-z", "--no-renames", "--diff-filter=a", commit, now)
+	if err != nil || changed == "" {
+		return err
+	}
+	tmp, err := os.MkdirTemp("", "trace-checkpoint-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(tmp, "index")}
+	if _, err := s.run(env, "read-tree", commit); err != nil {
+		return err
+	}
+	_, err = s.runInput(env, changed, "checkout-index", "-f", "-z", "--stdin")
+	return err
+}
+
+// run runs git in the repository root with extra environment variables
+func (s *Store) run(env []string, args ...string) (string, error) {
+	return s.runInput(env, "", args...)
+}
+
+// runInput runs git like run, with input on stdin
+func (s *Store) runInput(env []string, input string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = s.root
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// --- File backups outside git ---
+
+func (s *Store) backupDir(id int) string {
+	return filepath.Join(s.root, config.ProjectDir, "checkpoints", s.session, fmt.Sprint(id))
+}
+
+// rel returns path relative to the root, refusing paths outside it
+func (s *Store) rel(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(s.root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside %s", path, s.root)
+	}
+	return rel, nil
+}
+
+func (s *Store) restoreBackup(dir string) error {
+	files, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	for rel, existed := range files {
+		target := filepath.Join(s.root, rel)
+		if !existed {
+			os.Remove(target)
+			continue
+		}
+		if err := copyFile(filepath.Join(dir, "files", rel), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readManifest(dir string) (manifest, error) {
+	files := make(manifest)
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if os.IsNotExist(err) {
+		return files, nil
+	}
+	if err != nil {
+		return files, err
+	}
+	return files, json.Unmarshal(data, &files)
+}
+
+func writeManifest(dir string, files manifest) error {
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "manifest.json"), data, 0644)
+}
+
+// copyFile copies src to dst, keeping its permissions
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
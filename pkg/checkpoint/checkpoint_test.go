@@ -0,0 +1,149 @@
+package checkpoint
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func expectFile(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if want == "" {
+		if !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be gone, got %q", filepath.Base(path), got)
+		}
+		return
+	}
+	if err != nil || string(got) != want {
+		t.Errorf("Expected %s to contain %q, got %q (%v)", filepath.Base(path), want, got, err)
+	}
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), gitIdentity...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %s", args, out)
+	}
+	return string(out)
+}
+
+func TestGitCheckpoints(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	git(t, dir, "init", "-q")
+	writeFiles(t, dir, map[string]string{"a.txt": "one", "same.txt": "same", ".gitignore": "ignored\n"})
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "init")
+	writeFiles(t, dir, map[string]string{"a.txt": "two", "untracked.txt": "kept", "ignored": "x"})
+
+	s := NewStore(dir)
+	if !s.git {
+		t.Fatal("Expected a git store")
+	}
+	cp, err := s.Create("first turn")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	status := git(t, dir, "status", "--porcelain")
+
+	// The turn edits, deletes and creates files
+	writeFiles(t, dir, map[string]string{"a.txt": "three", "new/file.txt": "new"})
+	os.Remove(filepath.Join(dir, "untracked.txt"))
+	s.Create("second turn")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(filepath.Join(dir, "same.txt"), old, old)
+
+	if err := s.Restore(cp.ID); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	// Files nobody changed are not rewritten
+	if info, err := os.Stat(filepath.Join(dir, "same.txt")); err != nil || !info.ModTime().Equal(old) {
+		t.Errorf("Expected same.txt untouched, got %v (%v)", info.ModTime(), err)
+	}
+	expectFile(t, filepath.Join(dir, "a.txt"), "two")
+	expectFile(t, filepath.Join(dir, "untracked.txt"), "kept")
+	expectFile(t, filepath.Join(dir, "new/file.txt"), "")
+	expectFile(t, filepath.Join(dir, "ignored"), "x")
+
+	// The user's index and refs are as they were
+	if got := git(t, dir, "status", "--porcelain"); got != status {
+		t.Errorf("Expected git status unchanged:\n%s\ngot:\n%s", status, got)
+	}
+	if refs := git(t, dir, "for-each-ref", refPrefix); refs != "" {
+		t.Errorf("Expected the dropped checkpoint refs deleted, got %s", refs)
+	}
+	if len(s.List()) != 0 {
+		t.Errorf("Expected checkpoints from the restored one on dropped, got %d", len(s.List()))
+	}
+
+	// Ending the session deletes the refs of its remaining checkpoints
+	s.Create("third turn")
+	if refs := git(t, dir, "for-each-ref", refPrefix); refs == "" {
+		t.Fatal("Expected a checkpoint ref")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if refs := git(t, dir, "for-each-ref", refPrefix); refs != "" {
+		t.Errorf("Expected no checkpoint refs after Close, got %s", refs)
+	}
+}
+
+func TestFileCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "one", "b.txt": "b"})
+	s := NewStore(dir)
+	s.git = false // TempDir may sit inside a repository
+	s.root = dir
+
+	cp, _ := s.Create("first turn")
+	s.Track(filepath.Join(dir, "a.txt"))
+	writeFiles(t, dir, map[string]string{"a.txt": "two"})
+	s.Track(filepath.Join(dir, "a.txt")) // Only the first change per turn is kept
+
+	s.Create("second turn")
+	s.Track(filepath.Join(dir, "a.txt"))
+	s.Track(filepath.Join(dir, "c.txt"))
+	writeFiles(t, dir, map[string]string{"a.txt": "three", "c.txt": "new"})
+	s.Track(filepath.Join(dir, "b.txt"))
+	os.Remove(filepath.Join(dir, "b.txt"))
+
+	if err := s.Restore(cp.ID); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	expectFile(t, filepath.Join(dir, "a.txt"), "one")
+	expectFile(t, filepath.Join(dir, "b.txt"), "b")
+	expectFile(t, filepath.Join(dir, "c.txt"), "")
+
+	// Ending the session removes its backups
+	s.Create("third turn")
+	s.Track(filepath.Join(dir, "a.txt"))
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".trace", "checkpoints")); !os.IsNotExist(err) {
+		t.Errorf("Expected the backups removed after Close, got %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ProjectDir is the per-project directory for Trace's config and state
+const ProjectDir = ".trace"
+
+// FileName is the name of the config file in both the user and project directories
+const FileName = "config.json"
+
+// Config is loaded from ~/.config/trace/config.json and then .trace/config.json,
+// with fields in the project file overriding the user file.
+type Config struct {
+	Agent      AgentConfig          `json:"agent"`
+	Retry      RetryConfig          `json:"retry"`
+	Fallback   *ModelProfile        `json:"fallback_model,omitempty"`
+	Tools      ToolsConfig          `json:"tools"`
+	MCPServers map[string]MCPServer `json:"mcp_servers,omitempty"`
+	Hooks      HooksConfig          `json:"hooks"`
+}
+
+// AgentConfig tunes the agentic loop
+type AgentConfig struct {
+	MaxIterations      int `json:"max_iterations,omitempty"`      // Model calls per user turn before asking to continue
+	ContinueIterations int `json:"continue_iterations,omitempty"` // Extra model calls granted when the user continues
+	LoopThreshold      int `json:"loop_threshold,omitempty"`      // Identical tool calls in one turn before warning the model
+}
+
+// RetryConfig controls retries of failed provider calls
+type RetryConfig struct {
+	MaxAttempts   int `json:"max_attempts,omitempty"`   // Total attempts per model call, including the first
+	BaseDelayMs   int `json:"base_delay_ms,omitempty"`  // First backoff delay, doubled on each retry
+	MaxDelayMs    int `json:"max_delay_ms,omitempty"`   // Backoff cap (Retry-After headers may exceed it)
+	FallbackAfter int `json:"fallback_after,omitempty"` // Consecutive failures before switching to fallback_model
+}
+
+// ModelProfile is a secondary model, possibly on a different OpenAI-compatible provider
+type ModelProfile struct {
+	Model     string `json:"model"`
+	BaseURL   string `json:"base_url,omitempty"`
+	APIKeyEnv string `json:"api_key_env,omitempty"` // Name of the env var holding the API key
+}
+
+// ToolsConfig controls which tools the agent can use
+type ToolsConfig struct {
+	Enabled  []string `json:"enabled,omitempty"`  // Allowlist, empty means all tools
+	Disabled []string `json:"disabled,omitempty"` // Denylist, applied after the allowlist
+	Plugins  []Plugin `json:"plugins,omitempty"`  // External executable tools
+}
+
+// Plugin declares an external executable tool.
+// The executable receives the tool arguments as JSON on stdin and must print a JSON
+// object of the form {"output": "...", "error": "..."} on stdout.
+type Plugin struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Command     string          `json:"command"`
+	Args        []string        `json:"args,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"` // JSON schema for the tool input
+	Timeout     int             `json:"timeout,omitempty"`    // Seconds, defaults to 60
+}
+
+// HooksConfig declares commands run around the agent's tool calls
+type HooksConfig struct {
+	PostEdit []Hook `json:"post_edit,omitempty"` // Run after a tool writes a file matching the glob
+}
+
+// Hook is a command run for files matching Glob. A glob without a slash matches the file
+// name, one with a slash the path relative to the project. {file} and {dir} in Args are
+// replaced with the file and its directory; without either, the file is appended.
+type Hook struct {
+	Glob    string   `json:"glob"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	Timeout int      `json:"timeout,omitempty"` // Seconds, defaults to 30
+}
+
+// MCPServer declares a stdio MCP server whose tools are exposed to the agent
+type MCPServer struct {
+	Command  string            `json:"command"`
+	Args     []string          `json:"args,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	Timeout  int               `json:"timeout,omitempty"` // Seconds per tool call, defaults to 60
+	Disabled bool              `json:"disabled,omitempty"`
+}
+
+// UserDir returns the user-global Trace directory (~/.config/trace on Linux)
+func UserDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "trace")
+}
+
+// Paths returns the config files to load, lowest precedence first
+func Paths() []string {
+	var paths []string
+	if dir := UserDir(); dir != "" {
+		paths = append(paths, filepath.Join(dir, FileName))
+	}
+	return append(paths, filepath.Join(ProjectDir, FileName))
+}
+
+// Default returns the built-in configuration that config files are layered on
+func Default() Config {
+	return Config{
+		Agent: AgentConfig{
+			MaxIterations:      10,
+			ContinueIterations: 10,
+			LoopThreshold:      3,
+		},
+		Retry: RetryConfig{
+			MaxAttempts:   5,
+			BaseDelayMs:   1000,
+			MaxDelayMs:    30000,
+			FallbackAfter: 3,
+		},
+	}
+}
+
+// Load reads every config file that exists on top of the defaults. Missing files are not an error.
+func Load() (Config, error) {
+	cfg := Default()
+	for _, path := range Paths() {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return cfg, err
+		}
+		// Decoding into the same struct lets later files override earlier ones field by field
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,246 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+
+	"github.com/bethel-nz/trace/pkg/config"
+)
+
+// Client talks to a single MCP server over stdio
+type Client struct {
+	Name       string
+	ServerInfo Implementation
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  int
+	pending map[string]chan message
+	closed  bool
+	done    chan struct{}
+}
+
+// Start launches the server process and performs the initialize handshake
+func Start(ctx context.Context, name string, server config.MCPServer) (*Client, error) {
+	if server.Command == "" {
+		return nil, fmt.Errorf("mcp server %s is missing a command", name)
+	}
+
+	cmd := exec.Command(server.Command, server.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range server.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start mcp server %s: %w", name, err)
+	}
+
+	c := &Client{
+		Name:    name,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[string]chan message),
+		done:    make(chan struct{}),
+	}
+
+	// Server logs go to our log file, never to the terminal
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			slog.Debug("MCP server stderr", "server", name, "line", scanner.Text())
+		}
+	}()
+	go c.readLoop(stdout)
+
+	if err := c.initialize(ctx); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("mcp server %s: %w", name, err)
+	}
+	return c, nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	var result InitializeResult
+	err := c.call(ctx, "initialize", InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      Implementation{Name: "trace", Version: Version},
+	}, &result)
+	if err != nil {
+		return fmt.Errorf("initialize failed: %w", err)
+	}
+	c.ServerInfo = result.ServerInfo
+	slog.Info("MCP server initialized", "server", c.Name, "serverName", result.ServerInfo.Name, "protocolVersion", result.ProtocolVersion)
+
+	return c.notify("notifications/initialized", nil)
+}
+
+// ListTools returns every tool the server advertises, following pagination
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for {
+		var result ListToolsResult
+		if err := c.call(ctx, "tools/list", ListToolsParams{Cursor: cursor}, &result); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool invokes a tool on the server
+func (c *Client) CallTool(ctx context.Context, name string, args json.RawMessage) (CallToolResult, error) {
+	var result CallToolResult
+	err := c.call(ctx, "tools/call", CallToolParams{Name: name, Arguments: args}, &result)
+	return result, err
+}
+
+// Close stops the server process
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	c.stdin.Close()
+	if c.cmd.Process != nil {
+		c.cmd.Process.Kill()
+	}
+	return c.cmd.Wait()
+}
+
+// --- JSON-RPC plumbing ---
+
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return errors.New("client is closed")
+	}
+	c.nextID++
+	key := strconv.Itoa(c.nextID)
+	id := json.RawMessage(key)
+	ch := make(chan message, 1)
+	c.pending[key] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, key)
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(message{JSONRPC: "2.0", ID: &id, Method: method, Params: rawParams}); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 {
+			return json.Unmarshal(resp.Result, result)
+		}
+		return nil
+	case <-c.done:
+		return errors.New("server exited")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) notify(method string, params any) error {
+	msg := message{JSONRPC: "2.0", Method: method}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = raw
+	}
+	return c.send(msg)
+}
+
+func (c *Client) send(msg message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (c *Client) readLoop(r io.Reader) {
+	defer close(c.done)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			slog.Warn("Invalid message from MCP server", "server", c.Name, "error", err)
+			continue
+		}
+
+		switch {
+		case msg.Method != "" && msg.ID != nil:
+			// Server-to-client requests (sampling, roots, ...) are not supported; ping is
+			if msg.Method == "ping" {
+				c.send(message{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage("{}")})
+			} else {
+				c.send(message{JSONRPC: "2.0", ID: msg.ID, Error: &RPCError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}})
+			}
+		case msg.Method != "":
+			// Notifications are informational only
+			slog.Debug("MCP notification", "server", c.Name, "method", msg.Method)
+		case msg.ID != nil:
+			c.mu.Lock()
+			ch, ok := c.pending[string(*msg.ID)]
+			c.mu.Unlock()
+			if ok {
+				ch <- msg
+			}
+		}
+	}
+}
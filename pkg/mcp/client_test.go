@@ -0,0 +1,120 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bethel-nz/trace/pkg/agent"
+	"github.com/bethel-nz/trace/pkg/config"
+)
+
+// TestHelperStubServer is not a real test; it is launched as a tiny MCP server by the client tests
+func TestHelperStubServer(t *testing.T) {
+	if os.Getenv("TRACE_TEST_MCP_STUB") != "1" {
+		return
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req message
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || req.ID == nil {
+			continue // Notifications need no reply
+		}
+
+		var result any
+		switch req.Method {
+		case "initialize":
+			result = InitializeResult{ProtocolVersion: ProtocolVersion, ServerInfo: Implementation{Name: "stub", Version: "1"}}
+		case "tools/list":
+			result = ListToolsResult{Tools: []Tool{{
+				Name:        "echo",
+				Description: "Echo the input",
+				InputSchema: json.RawMessage(`{"type":"object","properties":{"text":{"type":"string"}},"required":["text"]}`),
+			}}}
+		case "tools/call":
+			var params CallToolParams
+			json.Unmarshal(req.Params, &params)
+			var args struct {
+				Text string `json:"text"`
+			}
+			json.Unmarshal(params.Arguments, &args)
+			if args.Text == "" {
+				result = CallToolResult{Content: []Content{{Type: "text", Text: "text is required"}}, IsError: true}
+			} else {
+				result = CallToolResult{Content: []Content{{Type: "text", Text: "echo: " + args.Text}}}
+			}
+		default:
+			fmt.Printf(`{"jsonrpc":"2.0","id":%s,"error":{"code":-32601,"message":"not found"}}`+"\n", *req.ID)
+			continue
+		}
+
+		raw, _ := json.Marshal(result)
+		resp, _ := json.Marshal(message{JSONRPC: "2.0", ID: req.ID, Result: raw})
+		fmt.Println(string(resp))
+	}
+	os.Exit(0)
+}
+
+func stubServer(t *testing.T) config.MCPServer {
+	return config.MCPServer{
+		Command: os.Args[0],
+		Args:    []string{"-test.run=TestHelperStubServer"},
+		Env:     map[string]string{"TRACE_TEST_MCP_STUB": "1"},
+	}
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	client, err := Start(context.Background(), "stub", stubServer(t))
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer client.Close()
+
+	if client.ServerInfo.Name != "stub" {
+		t.Errorf("Expected server name 'stub', got %q", client.ServerInfo.Name)
+	}
+
+	tools, err := client.ListTools(context.Background())
+	if err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+	if len(tools) != 1 || tools[0].Name != "echo" {
+		t.Fatalf("Unexpected tools: %+v", tools)
+	}
+
+	result, err := client.CallTool(context.Background(), "echo", json.RawMessage(`{"text":"hi"}`))
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if result.Text() != "echo: hi" {
+		t.Errorf("Unexpected result: %q", result.Text())
+	}
+}
+
+func TestStartServersRegistersTools(t *testing.T) {
+	registry := agent.NewRegistry()
+	manager := StartServers(context.Background(), map[string]config.MCPServer{"my.stub": stubServer(t)}, registry)
+	defer manager.Close()
+
+	// Names are namespaced and sanitised for model APIs
+	name := "mcp__my_stub__echo"
+	if _, ok := registry.Get(name); !ok {
+		t.Fatalf("Expected %s to be registered, got %v", name, registry.Names())
+	}
+
+	// Calls are routed through the registry like any built-in tool
+	out := registry.Execute(name, json.RawMessage(`{"text":"routed"}`))
+	if out.IsError || out.Content != "echo: routed" {
+		t.Errorf("Unexpected result: %+v", out)
+	}
+
+	// isError results surface as error results
+	if out := registry.Execute(name, json.RawMessage(`{}`)); !out.IsError || !strings.Contains(out.Content, "text is required") {
+		t.Errorf("Expected tool error, got %+v", out)
+	}
+}
@@ -0,0 +1,164 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/bethel-nz/trace/pkg/agent"
+)
+
+// Server exposes the tools in a registry over MCP's stdio transport.
+// Tools run through the registry, so disabled tools and the tools' own path checks
+// (such as .env protection) apply exactly as they do in the TUI.
+type Server struct {
+	registry *agent.Registry
+	out      io.Writer
+	writeMu  sync.Mutex
+}
+
+// NewServer creates a server publishing the enabled, non-UI tools of registry
+func NewServer(registry *agent.Registry) *Server {
+	return &Server{registry: registry}
+}
+
+// Serve reads requests from in and writes responses to out until in is closed or ctx is done
+func (s *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	s.out = out
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			s.reply(nil, nil, &RPCError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+		if msg.ID == nil {
+			// Notifications (e.g. notifications/initialized) need no reply
+			slog.Debug("MCP notification received", "method", msg.Method)
+			continue
+		}
+
+		// Tool calls may be slow, so handle them concurrently to keep ping responsive
+		if msg.Method == "tools/call" {
+			wg.Add(1)
+			go func(msg message) {
+				defer wg.Done()
+				s.handle(msg)
+			}(msg)
+			continue
+		}
+		s.handle(msg)
+	}
+	return scanner.Err()
+}
+
+func (s *Server) handle(msg message) {
+	switch msg.Method {
+	case "initialize":
+		var params InitializeParams
+		json.Unmarshal(msg.Params, &params)
+		slog.Info("MCP client connected", "client", params.ClientInfo.Name, "protocolVersion", params.ProtocolVersion)
+		s.reply(msg.ID, InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    map[string]any{"tools": map[string]any{}},
+			ServerInfo:      Implementation{Name: "trace", Version: Version},
+		}, nil)
+
+	case "ping":
+		s.reply(msg.ID, struct{}{}, nil)
+
+	case "tools/list":
+		s.reply(msg.ID, ListToolsResult{Tools: s.tools()}, nil)
+
+	case "tools/call":
+		var params CallToolParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			s.reply(msg.ID, nil, &RPCError{Code: codeInvalidParams, Message: err.Error()})
+			return
+		}
+		s.reply(msg.ID, s.callTool(params), nil)
+
+	default:
+		s.reply(msg.ID, nil, &RPCError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method})
+	}
+}
+
+// tools lists the registry's enabled tools, skipping those that only make sense inside the TUI
+func (s *Server) tools() []Tool {
+	tools := []Tool{}
+	for _, def := range s.registry.Enabled() {
+		if def.UIOnly {
+			continue
+		}
+		schema, err := json.Marshal(def.Parameters)
+		if err != nil {
+			slog.Warn("Skipping tool with unserialisable schema", "tool", def.Name, "error", err)
+			continue
+		}
+		tools = append(tools, Tool{Name: def.Name, Description: def.Description, InputSchema: schema})
+	}
+	return tools
+}
+
+func (s *Server) callTool(params CallToolParams) CallToolResult {
+	if def, ok := s.registry.Get(params.Name); ok && def.UIOnly {
+		return errorResult("tool " + params.Name + " is only available inside the Trace TUI")
+	}
+
+	args := params.Arguments
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+
+	slog.Info("MCP tool call", "name", params.Name)
+	// MCP has a native error flag, so the content stays as the tool produced it
+	result := s.registry.Execute(params.Name, args)
+	if result.IsError {
+		slog.Error("MCP tool call failed", "name", params.Name, "exitCode", result.ExitCode, "error", result.Summary())
+	}
+	return CallToolResult{Content: []Content{{Type: "text", Text: result.Content}}, IsError: result.IsError}
+}
+
+func errorResult(text string) CallToolResult {
+	return CallToolResult{Content: []Content{{Type: "text", Text: text}}, IsError: true}
+}
+
+func (s *Server) reply(id *json.RawMessage, result any, rpcErr *RPCError) {
+	msg := message{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if id == nil {
+		// JSON-RPC requires "id": null on errors for unparseable requests
+		null := json.RawMessage("null")
+		msg.ID = &null
+	}
+	if rpcErr == nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			msg.Error = &RPCError{Code: codeInternalError, Message: err.Error()}
+		} else {
+			msg.Result = raw
+		}
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("Failed to encode MCP response", "error", err)
+		return
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.out.Write(append(data, '\n'))
+}
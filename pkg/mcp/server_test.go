@@ -0,0 +1,78 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bethel-nz/trace/pkg/agent"
+)
+
+func TestServer(t *testing.T) {
+	registry := agent.NewRegistry()
+	registry.Register(agent.ReadFileDefinition)
+	registry.Register(agent.ManageWindowDefinition)
+
+	path := filepath.Join(t.TempDir(), "hello.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	readArgs, _ := json.Marshal(map[string]string{"path": path})
+
+	requests := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"read_file","arguments":` + string(readArgs) + `}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"read_file","arguments":{"path":".env"}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"manage_window","arguments":{"action":"open"}}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"nope"}`,
+	}
+
+	var out strings.Builder
+	if err := NewServer(registry).Serve(context.Background(), strings.NewReader(strings.Join(requests, "\n")), &out); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+
+	// Tool calls are answered concurrently, so index responses by id
+	responses := map[string]message{}
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatalf("Invalid response %q: %v", scanner.Text(), err)
+		}
+		responses[string(*msg.ID)] = msg
+	}
+	if len(responses) != 6 {
+		t.Fatalf("Expected 6 responses (no reply to notifications), got %d:\n%s", len(responses), out.String())
+	}
+
+	var list ListToolsResult
+	json.Unmarshal(responses["2"].Result, &list)
+	if len(list.Tools) != 1 || list.Tools[0].Name != "read_file" || !strings.Contains(string(list.Tools[0].InputSchema), `"path"`) {
+		t.Errorf("Expected only read_file with its schema, got %+v", list.Tools)
+	}
+
+	callResult := func(id string) CallToolResult {
+		var r CallToolResult
+		json.Unmarshal(responses[id].Result, &r)
+		return r
+	}
+	if r := callResult("3"); r.IsError || !strings.Contains(r.Text(), "hello") {
+		t.Errorf("Expected file contents, got %+v", r)
+	}
+	if r := callResult("4"); !r.IsError || !strings.Contains(r.Text(), "access denied") {
+		t.Errorf("Expected .env to be protected, got %+v", r)
+	}
+	if r := callResult("5"); !r.IsError {
+		t.Errorf("Expected UI-only tool to be refused, got %+v", r)
+	}
+	if responses["6"].Error == nil || responses["6"].Error.Code != codeMethodNotFound {
+		t.Errorf("Expected method not found, got %+v", responses["6"])
+	}
+}
@@ -0,0 +1,132 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/bethel-nz/trace/pkg/agent"
+	"github.com/bethel-nz/trace/pkg/config"
+
+	"github.com/invopop/jsonschema"
+)
+
+// ToolPrefix namespaces MCP tools so they cannot collide with built-in tools
+const ToolPrefix = "mcp__"
+
+// Model APIs only accept [a-zA-Z0-9_-] in function names
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// ToolName returns the namespaced name of a server's tool, e.g. mcp__github__create_issue
+func ToolName(server, tool string) string {
+	return ToolPrefix + invalidNameChars.ReplaceAllString(server, "_") + "__" + invalidNameChars.ReplaceAllString(tool, "_")
+}
+
+// ToolDefinitions adapts the server's tools into agent tool definitions
+func (c *Client) ToolDefinitions(ctx context.Context, timeout time.Duration) ([]agent.ToolDefinition, error) {
+	tools, err := c.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var defs []agent.ToolDefinition
+	for _, tool := range tools {
+		schema := jsonschema.Schema{Type: "object"}
+		if len(tool.InputSchema) > 0 {
+			if err := json.Unmarshal(tool.InputSchema, &schema); err != nil {
+				slog.Warn("Skipping MCP tool with invalid schema", "server", c.Name, "tool", tool.Name, "error", err)
+				continue
+			}
+		}
+
+		description := tool.Description
+		if description == "" {
+			description = tool.Name
+		}
+
+		remoteName := tool.Name
+		defs = append(defs, agent.ToolDefinition{
+			Name:        ToolName(c.Name, tool.Name),
+			Description: fmt.Sprintf("[MCP: %s] %s", c.Name, description),
+			Parameters:  schema,
+			Function: func(input json.RawMessage) (agent.ToolResult, error) {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+
+				result, err := c.CallTool(ctx, remoteName, input)
+				if err != nil {
+					return agent.ToolResult{}, err
+				}
+				return agent.ToolResult{
+					Content:  result.Text(),
+					IsError:  result.IsError,
+					Metadata: map[string]any{"server": c.Name},
+				}, nil
+			},
+		})
+	}
+	return defs, nil
+}
+
+// Manager owns the MCP servers started for a session
+type Manager struct {
+	Clients []*Client
+}
+
+// StartServers launches every enabled server from config and registers its tools.
+// A server that fails to start is logged and skipped so one broken server does not block Trace.
+func StartServers(ctx context.Context, servers map[string]config.MCPServer, registry *agent.Registry) *Manager {
+	m := &Manager{}
+
+	// Deterministic order so tool registration (and the system prompt) is stable
+	var names []string
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		server := servers[name]
+		if server.Disabled {
+			continue
+		}
+
+		startCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		client, err := Start(startCtx, name, server)
+		if err != nil {
+			cancel()
+			slog.Error("Failed to start MCP server", "server", name, "error", err)
+			continue
+		}
+
+		timeout := time.Duration(server.Timeout) * time.Second
+		if timeout <= 0 {
+			timeout = 60 * time.Second
+		}
+		defs, err := client.ToolDefinitions(startCtx, timeout)
+		cancel()
+		if err != nil {
+			slog.Error("Failed to list MCP tools", "server", name, "error", err)
+			client.Close()
+			continue
+		}
+
+		for _, def := range defs {
+			registry.Register(def)
+		}
+		slog.Info("Registered MCP tools", "server", name, "count", len(defs))
+		m.Clients = append(m.Clients, client)
+	}
+	return m
+}
+
+// Close stops every server
+func (m *Manager) Close() {
+	for _, c := range m.Clients {
+		c.Close()
+	}
+}
@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bethel-nz/trace/pkg/config"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Target is a model on a specific provider client
+type Target struct {
+	Name   string // Shown to the user, e.g. "primary" or "fallback"
+	Client *openai.Client
+	Model  string
+}
+
+// NewClient creates an OpenAI-compatible client whose transport records Retry-After headers
+func NewClient(apiKey, baseURL string) *openai.Client {
+	clientConfig := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		clientConfig.BaseURL = baseURL
+	}
+	clientConfig.HTTPClient = &http.Client{Transport: &retryAfterTransport{base: http.DefaultTransport}}
+	return openai.NewClientWithConfig(clientConfig)
+}
+
+// NewTarget builds a target from a model profile in config
+func NewTarget(name string, profile config.ModelProfile) (*Target, error) {
+	if profile.Model == "" {
+		return nil, fmt.Errorf("%s model profile is missing a model", name)
+	}
+	apiKey := ""
+	if profile.APIKeyEnv != "" {
+		apiKey = os.Getenv(profile.APIKeyEnv)
+		if apiKey == "" {
+			return nil, fmt.Errorf("%s model profile: %s is not set", name, profile.APIKeyEnv)
+		}
+	}
+	return &Target{Name: name, Client: NewClient(apiKey, profile.BaseURL), Model: profile.Model}, nil
+}
+
+// --- Retry-After capture ---
+
+// The OpenAI client does not expose response headers on errors, so the transport stores
+// Retry-After in a holder carried by the request context.
+type retryAfterKey struct{}
+
+type retryAfterHolder struct {
+	mu    sync.Mutex
+	delay time.Duration
+}
+
+func withRetryAfter(ctx context.Context) (context.Context, *retryAfterHolder) {
+	holder := &retryAfterHolder{}
+	return context.WithValue(ctx, retryAfterKey{}, holder), holder
+}
+
+func (h *retryAfterHolder) take() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	d := h.delay
+	h.delay = 0
+	return d
+}
+
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode < 400 {
+		return resp, err
+	}
+	if holder, ok := req.Context().Value(retryAfterKey{}).(*retryAfterHolder); ok {
+		if d := parseRetryAfter(resp.Header.Get("Retry-After")); d > 0 {
+			holder.mu.Lock()
+			holder.delay = d
+			holder.mu.Unlock()
+		}
+	}
+	return resp, err
+}
+
+// parseRetryAfter accepts both forms from RFC 9110: delay-seconds and an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
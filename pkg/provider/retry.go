@@ -0,0 +1,169 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/bethel-nz/trace/pkg/config"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxRetryAfter caps how long a server can make us wait
+const maxRetryAfter = 5 * time.Minute
+
+// Policy controls retries of provider calls
+type Policy struct {
+	MaxAttempts   int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	FallbackAfter int // Consecutive failures before switching to the fallback target, 0 disables
+}
+
+// PolicyFromConfig converts the retry section of the config
+func PolicyFromConfig(c config.RetryConfig) Policy {
+	return Policy{
+		MaxAttempts:   c.MaxAttempts,
+		BaseDelay:     time.Duration(c.BaseDelayMs) * time.Millisecond,
+		MaxDelay:      time.Duration(c.MaxDelayMs) * time.Millisecond,
+		FallbackAfter: c.FallbackAfter,
+	}
+}
+
+// Backoff returns the wait before retry number attempt (1-based): exponential growth
+// capped at MaxDelay, with "equal jitter" so concurrent clients spread out.
+func (p Policy) Backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + rand.N(half)
+}
+
+// RetryEvent describes a retry so the UI can show a countdown
+type RetryEvent struct {
+	Attempt     int // The attempt that failed
+	MaxAttempts int
+	Wait        time.Duration
+	Err         error
+	Reason      string // Short classification, e.g. "rate limited"
+	Target      string
+	Fallback    bool // Switched to the fallback target
+	Done        bool // The call finally succeeded or gave up; clear any countdown
+}
+
+// Classify reports whether an error is worth retrying and why
+func Classify(err error) (retryable bool, reason string) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false, ""
+	}
+
+	status := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	}
+
+	switch {
+	case status == 429:
+		return true, "rate limited"
+	case status == 408 || status == 409:
+		return true, "request timeout"
+	case status == 529:
+		return true, "provider overloaded"
+	case status >= 500:
+		return true, fmt.Sprintf("server error %d", status)
+	case status > 0:
+		// Other 4xx errors (bad request, auth) will not fix themselves
+		return false, ""
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) || errors.Is(err, context.DeadlineExceeded) {
+		return true, "network error"
+	}
+	return false, ""
+}
+
+// CreateChatCompletion calls the provider, retrying transient failures with backoff and
+// switching to fallback (if any) after policy.FallbackAfter consecutive failures.
+// notify may be nil.
+func CreateChatCompletion(ctx context.Context, primary Target, fallback *Target, policy Policy, req openai.ChatCompletionRequest, notify func(RetryEvent)) (openai.ChatCompletionResponse, error) {
+	if notify == nil {
+		notify = func(RetryEvent) {}
+	}
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	target := primary
+	failures := 0
+	retried := false
+	for attempt := 1; ; attempt++ {
+		if target.Model != "" {
+			req.Model = target.Model
+		}
+
+		callCtx, holder := withRetryAfter(ctx)
+		resp, err := target.Client.CreateChatCompletion(callCtx, req)
+		if err == nil {
+			if retried {
+				notify(RetryEvent{Done: true})
+			}
+			return resp, nil
+		}
+
+		retryable, reason := Classify(err)
+		if !retryable || attempt >= maxAttempts {
+			if retried {
+				notify(RetryEvent{Done: true})
+			}
+			return resp, err
+		}
+		retried = true
+		failures++
+		slog.Warn("Provider call failed, retrying", "target", target.Name, "attempt", attempt, "reason", reason, "error", err)
+
+		// Repeated failures on the primary: try the fallback straight away
+		if fallback != nil && target.Name != fallback.Name && policy.FallbackAfter > 0 && failures >= policy.FallbackAfter {
+			target = *fallback
+			failures = 0
+			slog.Warn("Switching to fallback model", "model", target.Model)
+			notify(RetryEvent{Attempt: attempt, MaxAttempts: maxAttempts, Err: err, Reason: reason, Target: target.Name, Fallback: true})
+			continue
+		}
+
+		wait := policy.Backoff(failures)
+		if after := holder.take(); after > 0 {
+			wait = min(after, maxRetryAfter)
+		}
+		notify(RetryEvent{Attempt: attempt, MaxAttempts: maxAttempts, Wait: wait, Err: err, Reason: reason, Target: target.Name})
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			notify(RetryEvent{Done: true})
+			return resp, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
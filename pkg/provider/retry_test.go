@@ -0,0 +1,139 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const okBody = `{"id":"1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`
+
+// stubServer fails with the given statuses in order, then succeeds
+func stubServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		w.Header().Set("Content-Type", "application/json")
+		if n <= len(statuses) {
+			w.Header().Set("Retry-After", "0.01")
+			w.WriteHeader(statuses[n-1])
+			fmt.Fprintf(w, `{"error":{"message":"failure %d","type":"error"}}`, n)
+			return
+		}
+		io.WriteString(w, okBody)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+var testPolicy = Policy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func TestCreateChatCompletionRetries(t *testing.T) {
+	srv, calls := stubServer(t, 429, 503)
+	target := Target{Name: "primary", Client: NewClient("key", srv.URL), Model: "m"}
+
+	var events []RetryEvent
+	resp, err := CreateChatCompletion(context.Background(), target, nil, testPolicy, openai.ChatCompletionRequest{}, func(e RetryEvent) {
+		events = append(events, e)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Choices[0].Message.Content != "hi" || calls.Load() != 3 {
+		t.Fatalf("got %q after %d calls", resp.Choices[0].Message.Content, calls.Load())
+	}
+	if len(events) != 3 || events[0].Reason != "rate limited" || events[0].Wait != 10*time.Millisecond || !events[2].Done {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
+
+func TestCreateChatCompletionGivesUp(t *testing.T) {
+	srv, calls := stubServer(t, 400)
+	target := Target{Name: "primary", Client: NewClient("key", srv.URL), Model: "m"}
+	if _, err := CreateChatCompletion(context.Background(), target, nil, testPolicy, openai.ChatCompletionRequest{}, nil); err == nil {
+		t.Fatal("expected error for bad request")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("bad request should not be retried, got %d calls", calls.Load())
+	}
+
+	srv, calls = stubServer(t, 500, 500, 500, 500, 500)
+	target.Client = NewClient("key", srv.URL)
+	if _, err := CreateChatCompletion(context.Background(), target, nil, testPolicy, openai.ChatCompletionRequest{}, nil); err == nil {
+		t.Fatal("expected error after exhausting attempts")
+	}
+	if calls.Load() != 4 {
+		t.Errorf("expected 4 attempts, got %d", calls.Load())
+	}
+}
+
+func TestCreateChatCompletionFallback(t *testing.T) {
+	primarySrv, _ := stubServer(t, 529, 529, 529, 529)
+	fallbackSrv, fallbackCalls := stubServer(t)
+
+	var gotModel string
+	fallbackSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackCalls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		gotModel = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, okBody)
+	})
+
+	primary := Target{Name: "primary", Client: NewClient("key", primarySrv.URL), Model: "big"}
+	fallback := &Target{Name: "fallback", Client: NewClient("key", fallbackSrv.URL), Model: "small"}
+	policy := testPolicy
+	policy.FallbackAfter = 2
+
+	if _, err := CreateChatCompletion(context.Background(), primary, fallback, policy, openai.ChatCompletionRequest{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fallbackCalls.Load() != 1 {
+		t.Fatalf("expected one fallback call, got %d", fallbackCalls.Load())
+	}
+	if want := `"model":"small"`; !strings.Contains(gotModel, want) {
+		t.Errorf("fallback request %s does not contain %s", gotModel, want)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{&openai.APIError{HTTPStatusCode: 429}, true},
+		{&openai.APIError{HTTPStatusCode: 500}, true},
+		{&openai.RequestError{HTTPStatusCode: 502}, true},
+		{&openai.APIError{HTTPStatusCode: 401}, false},
+		{fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{context.Canceled, false},
+		{errors.New("something else"), false},
+	}
+	for _, tt := range tests {
+		if got, _ := Classify(tt.err); got != tt.retryable {
+			t.Errorf("Classify(%v) = %v, want %v", tt.err, got, tt.retryable)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("3"); d != 3*time.Second {
+		t.Errorf("seconds: got %v", d)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if d := parseRetryAfter(date); d < 55*time.Second || d > time.Minute {
+		t.Errorf("http date: got %v", d)
+	}
+	if d := parseRetryAfter("soon"); d != 0 {
+		t.Errorf("invalid: got %v", d)
+	}
+}
@@ -0,0 +1,200 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bethel-nz/trace/pkg/config"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Conversation Branches ---
+
+// Selection IDs of user messages in the chat start with this prefix, followed by the history index
+const messageSelectPrefix = "msg:"
+
+// Hint appended to user messages by resolveFileTags, dropped when a message is edited
+var fileHintRe = regexp.MustCompile(`\n\n\[User has referenced these files:.*?\]`)
+
+// Session keeps every branch of the conversation and is saved to .trace/sessions
+type Session struct {
+	Path     string    `json:"-"` // Empty to keep the session in memory only
+	Created  time.Time `json:"created"`
+	Current  int       `json:"current"` // Index of the branch shown in the chat
+	Branches []Branch  `json:"branches"`
+}
+
+// Branch is one version of the conversation. Editing a user message forks a new branch
+// that shares its parent's history up to the edited message.
+type Branch struct {
+	Parent   int                            `json:"parent"`  // Index of the branch it was forked from, -1 for the first
+	ForkAt   int                            `json:"fork_at"` // History index of the edited message
+	Title    string                         `json:"title"`
+	Updated  time.Time                      `json:"updated"`
+	Messages []openai.ChatCompletionMessage `json:"messages"`
+}
+
+// newSession starts a session with a single branch
+func newSession(path string, history []openai.ChatCompletionMessage) *Session {
+	now := time.Now()
+	return &Session{
+		Path:     path,
+		Created:  now,
+		Branches: []Branch{{Parent: -1, Title: "main", Updated: now, Messages: history}},
+	}
+}
+
+// DefaultSessionPath names a new session file after its start time
+func DefaultSessionPath() string {
+	return filepath.Join(config.ProjectDir, "sessions", time.Now().Format("20060102-150405")+".json")
+}
+
+// Save writes every branch to the session file
+func (s *Session) Save() error {
+	if s.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.Path, data, 0644)
+}
+
+// syncBranch copies the live history into the current branch
+func (m *Model) syncBranch() {
+	branch := &m.Session.Branches[m.Session.Current]
+	branch.Messages = append([]openai.ChatCompletionMessage(nil), m.History...)
+	branch.Updated = time.Now()
+}
+
+// saveBranches syncs and writes the session file
+func (m *Model) saveBranches() {
+	m.syncBranch()
+	if err := m.Session.Save(); err != nil {
+		m.Status = fmt.Sprintf("Failed to save session: %v", err)
+	}
+	// Keep an open tree view current
+	if i := m.tabIndex("branches"); i != -1 {
+		m.Tabs[i].Output = m.renderBranchTree()
+		m.renderSidebar()
+	}
+}
+
+// editMessage loads a previous user message into the input; sending it forks a branch
+func (m *Model) editMessage(index int) {
+	if index < 0 || index >= len(m.History) || m.History[index].Role != openai.ChatMessageRoleUser {
+		return
+	}
+	m.EditingMessage = index + 1
+	m.Input.SetValue(fileHintRe.ReplaceAllString(m.History[index].Content, ""))
+	m.setFocus(FocusInput)
+	m.Status = "Editing an earlier message · enter re-runs from there on a new branch · esc cancels"
+}
+
+// cancelEdit leaves the history untouched and clears the draft
+func (m *Model) cancelEdit() {
+	m.EditingMessage = 0
+	m.Input.Reset()
+	m.Status = ""
+}
+
+// forkBranch starts a branch off the current one that keeps the history before index
+func (m *Model) forkBranch(index int, title string) {
+	m.syncBranch()
+	m.Session.Branches = append(m.Session.Branches, Branch{
+		Parent:  m.Session.Current,
+		ForkAt:  index,
+		Title:   truncate(title, 40),
+		Updated: time.Now(),
+	})
+	m.Session.Current = len(m.Session.Branches) - 1
+	m.History = append([]openai.ChatCompletionMessage(nil), m.History[:index]...)
+	m.SelectedCard = ""
+	m.EditingMessage = 0
+}
+
+// branchFrom forks a branch that replaces the user message at index with text and re-runs from there
+func (m *Model) branchFrom(index int, text string) tea.Cmd {
+	m.forkBranch(index, text)
+	m.beginTurn()
+	m.appendUserMessage(text)
+	m.Status = fmt.Sprintf("Branch %d", m.Session.Current+1)
+	m.saveBranches()
+
+	m.State = StateThinking
+	return m.startTurn()
+}
+
+// switchBranch shows another branch in the chat
+func (m *Model) switchBranch(i int) {
+	m.syncBranch()
+	m.Session.Current = i
+	m.History = append([]openai.ChatCompletionMessage(nil), m.Session.Branches[i].Messages...)
+	m.SelectedCard = ""
+	m.EditingMessage = 0
+	m.Status = fmt.Sprintf("Switched to branch %d", i+1)
+}
+
+// /branch     -> show the branch tree in the sidebar
+// /branch <n> -> switch to branch n
+func (m *Model) branchCommand(arg string) tea.Cmd {
+	if arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > len(m.Session.Branches) {
+			m.Status = fmt.Sprintf("Usage: /branch <1-%d>", len(m.Session.Branches))
+			return nil
+		}
+		if m.State != StateIdle {
+			m.Status = "Wait for the current turn to finish before switching branches"
+			return nil
+		}
+		m.switchBranch(n - 1)
+		m.Viewport.GotoBottom()
+	}
+	m.syncBranch()
+	m.openTab(SidebarTab{ID: "branches", Title: "branches", Kind: tabText, Output: m.renderBranchTree()})
+	return m.resizeCmd()
+}
+
+// renderBranchTree draws the branches as a tree, children indented under their parent
+func (m *Model) renderBranchTree() string {
+	children := make(map[int][]int)
+	for i, branch := range m.Session.Branches {
+		children[branch.Parent] = append(children[branch.Parent], i)
+	}
+
+	var b strings.Builder
+	var walk func(parent int, indent string)
+	walk = func(parent int, indent string) {
+		for _, i := range children[parent] {
+			branch := m.Session.Branches[i]
+			marker := "○"
+			if i == m.Session.Current {
+				marker = "●"
+			}
+			line := fmt.Sprintf("%s%s %d. %s", indent, marker, i+1, branch.Title)
+			meta := fmt.Sprintf(" · %d messages", len(branch.Messages))
+			if i == m.Session.Current {
+				b.WriteString(fileSelected.Render(line) + mutedStyle.UnsetMarginLeft().Render(meta) + "\n")
+			} else {
+				b.WriteString(line + mutedStyle.UnsetMarginLeft().Render(meta) + "\n")
+			}
+			walk(i, indent+"  ")
+		}
+	}
+	walk(-1, "")
+	b.WriteString("\n" + mutedStyle.UnsetMarginLeft().Render("/branch <n> to switch"))
+	return b.String()
+}
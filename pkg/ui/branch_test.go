@@ -0,0 +1,62 @@
+package ui
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bethel-nz/trace/pkg/config"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestBranching(t *testing.T) {
+	m := InitialModel(nil, config.Default(), nil, "")
+	m.Session = newSession(filepath.Join(t.TempDir(), "session.json"), nil)
+	m.Viewport.Width, m.Viewport.Height = 80, 100
+	m.History = []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "write a test\n\n[User has referenced these files: a.go. Use the read_file tool to view their contents.]"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "Done."},
+		{Role: openai.ChatMessageRoleUser, Content: "now delete it"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "Deleted."},
+	}
+	m.RenderChat()
+
+	// The first selectable item is the first user message; opening it starts an edit
+	m.selectCard(true)
+	m.toggleCard()
+	if m.EditingMessage != 1 || m.Input.Value() != "write a test" {
+		t.Fatalf("Expected the first message in the input, got %d %q", m.EditingMessage, m.Input.Value())
+	}
+
+	m.Input.SetValue("write two tests")
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(Model)
+	if len(m.History) != 1 || m.History[0].Content != "write two tests" || m.Session.Current != 1 {
+		t.Fatalf("Expected a new branch with the edited message, got %+v", m.History)
+	}
+
+	// The session file keeps both branches
+	data, err := os.ReadFile(m.Session.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Session
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Branches) != 2 || len(saved.Branches[0].Messages) != 4 || saved.Branches[1].Parent != 0 {
+		t.Errorf("Expected both branches saved, got %+v", saved.Branches)
+	}
+
+	m.State = StateIdle
+	m.branchCommand("1")
+	if len(m.History) != 4 || m.Session.Current != 0 {
+		t.Errorf("Expected the original branch back, got %d messages", len(m.History))
+	}
+	if tree := m.renderBranchTree(); !strings.Contains(tree, "  ○ 2. write two tests") {
+		t.Errorf("Expected branch 2 nested under branch 1:\n%s", tree)
+	}
+}
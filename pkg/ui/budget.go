@@ -0,0 +1,86 @@
+package ui
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Iteration Budget ---
+
+// MaxIterationsMsg is returned when a turn uses up its iteration budget.
+// History holds everything done so far so no work is lost.
+type MaxIterationsMsg struct {
+	Steps   int
+	History []openai.ChatCompletionMessage
+}
+
+// iterationBudget is the number of model calls allowed in the current turn
+func (m Model) iterationBudget() int {
+	return m.Config.Agent.MaxIterations + m.ExtraIterations
+}
+
+// beginTurn marks the end of the history as the start of a new turn. Steering typed
+// during a turn joins it, so it neither resets the budget nor the loop detection.
+func (m *Model) beginTurn() {
+	m.TurnStart = len(m.History)
+}
+
+// turnMessages returns the messages of the turn starting at index start
+func turnMessages(messages []openai.ChatCompletionMessage, start int) []openai.ChatCompletionMessage {
+	return messages[min(max(start, 0), len(messages)):]
+}
+
+// turnSteps counts the model calls made in the turn starting at index start
+func turnSteps(messages []openai.ChatCompletionMessage, start int) int {
+	steps := 0
+	for _, msg := range turnMessages(messages, start) {
+		if msg.Role == openai.ChatMessageRoleAssistant {
+			steps++
+		}
+	}
+	return steps
+}
+
+// repeatedCalls counts earlier tool calls in the turn starting at index start with the
+// same name and arguments as call
+func repeatedCalls(messages []openai.ChatCompletionMessage, start int, call openai.ToolCall) int {
+	count := 0
+	for _, msg := range turnMessages(messages, start) {
+		for _, tc := range msg.ToolCalls {
+			if tc.ID != call.ID && tc.Function.Name == call.Function.Name && tc.Function.Arguments == call.Function.Arguments {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// loopWarning returns a note for the model when it keeps repeating the same tool call
+func (m Model) loopWarning(messages []openai.ChatCompletionMessage, call openai.ToolCall) string {
+	threshold := m.Config.Agent.LoopThreshold
+	if threshold <= 0 {
+		return ""
+	}
+	n := repeatedCalls(messages, m.TurnStart, call) + 1
+	if n < threshold {
+		return ""
+	}
+	return fmt.Sprintf("\n\n[Warning: this is call #%d to %s with identical arguments in this turn. The result will not change. Try a different approach or explain to the user what is blocking you.]", n, call.Function.Name)
+}
+
+// continueTurn grants more iterations and resumes the agent
+func (m *Model) continueTurn() tea.Cmd {
+	m.ExtraIterations += m.Config.Agent.ContinueIterations
+	m.State = StateThinking
+	m.Status = ""
+	return m.InvokeAI()
+}
+
+// stopTurn ends a turn that hit its budget, keeping the partial history
+func (m *Model) stopTurn() tea.Cmd {
+	m.ExtraIterations = 0
+	m.Status = fmt.Sprintf("Stopped after %d steps", turnSteps(m.History, m.TurnStart))
+	return func() tea.Msg { return AiCompleteMsg{} }
+}
@@ -0,0 +1,91 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bethel-nz/trace/pkg/config"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+func toolCallMsg(id, name, args string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleAssistant,
+		ToolCalls: []openai.ToolCall{{
+			ID:       id,
+			Function: openai.FunctionCall{Name: name, Arguments: args},
+		}},
+	}
+}
+
+func TestTurnStepsAndLoopWarning(t *testing.T) {
+	history := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "old turn"},
+		toolCallMsg("0", "read_file", `{"path":"a"}`),
+		{Role: openai.ChatMessageRoleUser, Content: "new turn"},
+		toolCallMsg("1", "read_file", `{"path":"a"}`),
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "1"},
+		{Role: openai.ChatMessageRoleUser, Content: "steering"},
+		toolCallMsg("2", "read_file", `{"path":"a"}`),
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "2"},
+		toolCallMsg("3", "read_file", `{"path":"a"}`),
+	}
+
+	// Only the current turn counts, steering included
+	if steps := turnSteps(history, 2); steps != 3 {
+		t.Errorf("Expected 3 steps, got %d", steps)
+	}
+
+	m := Model{Config: config.Default(), TurnStart: 2}
+	current := history[len(history)-1].ToolCalls[0]
+	if warning := m.loopWarning(history, current); !strings.Contains(warning, "call #3") {
+		t.Errorf("Expected loop warning on the third identical call, got %q", warning)
+	}
+
+	// Different arguments are not a loop
+	other := openai.ToolCall{ID: "4", Function: openai.FunctionCall{Name: "read_file", Arguments: `{"path":"b"}`}}
+	if warning := m.loopWarning(history, other); warning != "" {
+		t.Errorf("Expected no warning, got %q", warning)
+	}
+}
+
+func TestBudgetSpansSteering(t *testing.T) {
+	t.Chdir(t.TempDir())
+	client := fakeModel(t, toolCalls("2", "list_files", `{}`))
+	cfg := config.Default()
+	cfg.Agent.MaxIterations = 2
+	m := InitialModel(client, cfg, nil, "")
+
+	// One step was taken before the user steered the turn
+	m.beginTurn()
+	m.History = append(m.History,
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "go"},
+		toolCallMsg("1", "list_files", `{}`),
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, ToolCallID: "1", Content: "."},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "steering"},
+	)
+	msg, ok := m.InvokeAI()().(MaxIterationsMsg)
+	if !ok || msg.Steps != 2 {
+		t.Fatalf("Expected the budget to stop the turn after 2 steps, got %+v", msg)
+	}
+}
+
+func TestBudgetPromptKeys(t *testing.T) {
+	m := InitialModel(nil, config.Default(), nil, "")
+	m.State = StateConfirmContinue
+
+	// Unrelated keys are swallowed while asking
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	if cmd != nil || next.(Model).State != StateConfirmContinue {
+		t.Fatal("Expected other keys to leave the prompt up")
+	}
+	// ctrl+c still quits
+	_, cmd = m.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	if cmd == nil {
+		t.Fatal("Expected ctrl+c to quit from the budget prompt")
+	}
+	if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Error("Expected a quit command")
+	}
+}
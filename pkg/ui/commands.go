@@ -31,12 +31,13 @@ type ProcessDoneMsg struct {
 	ToolCallID string
 }
 
-// RunProcessCmd executes a command and streams output to a channel
-func RunProcessCmd(command string, args []string, toolCallID string, sub chan tea.Msg) tea.Cmd {
+// RunProcessCmd executes a command and streams output to a channel.
+// The process is killed if ctx is cancelled, e.g. when the user steers the turn.
+func RunProcessCmd(ctx context.Context, command string, args []string, toolCallID string, sub chan tea.Msg) tea.Cmd {
 	return func() tea.Msg {
 		// Smart resolve command (e.g. python -> python3)
 		resolvedCmd := agent.ResolveBinary(command)
-		cmd := exec.Command(resolvedCmd, args...)
+		cmd := exec.CommandContext(ctx, resolvedCmd, args...)
 
 		// 1. Pipe both Stdout and Stderr
 		stdout, _ := cmd.StdoutPipe()
@@ -76,6 +77,14 @@ func WaitForProcessOutput(sub chan tea.Msg) tea.Cmd {
 	}
 }
 
+// RefreshFilesCmd re-lists the project files in the background
+func RefreshFilesCmd() tea.Cmd {
+	return func() tea.Msg {
+		files, _ := agent.ListProjectFiles()
+		return FilesRefreshedMsg(files)
+	}
+}
+
 // --- AI Commands ---
 
 type AiCompleteMsg struct{}
@@ -88,7 +97,7 @@ type AiResponseMsg struct {
 
 func (m Model) InvokeAI() tea.Cmd {
 	return func() tea.Msg {
-		modelName := os.Getenv("ANTHROPIC_MODEL")
+		modelName := modelName()
 		if modelName == "" {
 			slog.Error("ANTHROPIC_MODEL not set")
 			return ErrMsg(errors.New("ANTHROPIC_MODEL not set in .env"))
@@ -98,19 +107,38 @@ func (m Model) InvokeAI() tea.Cmd {
 		messages := make([]openai.ChatCompletionMessage, len(m.History))
 		copy(messages, m.History)
 
-		tools := convertToolsToOpenAI(agent.GetAllToolDefinitions())
+		tools := convertToolsToOpenAI(m.availableTools())
+
+		// Agentic loop - keep calling until we get a final response.
+		// Steps are counted from the history so the budget spans process/window round trips.
+		budget := m.iterationBudget()
+		for {
+			// Steering typed by the user since the last call joins the turn here
+			for _, text := range m.Turn.TakeSteering() {
+				messages = append(messages, openai.ChatCompletionMessage{
+					Role:    openai.ChatMessageRoleUser,
+					Content: m.resolveFileTags(text),
+				})
+			}
 
-		// Agentic loop - keep calling until we get a final response
-		for iteration := 0; iteration < 10; iteration++ { // Max 10 iterations to prevent infinite loops
+			iteration := turnSteps(messages, m.TurnStart)
+			if iteration >= budget {
+				slog.Warn("Iteration budget reached", "budget", budget)
+				return MaxIterationsMsg{Steps: iteration, History: messages}
+			}
 			slog.Info("Calling AI", "model", modelName, "messageCount", len(messages), "iteration", iteration)
 
 			req := openai.ChatCompletionRequest{
 				Model:    modelName,
-				Messages: messages,
+				Messages: m.requestMessages(messages),
 				Tools:    tools,
 			}
 
-			resp, err := m.Client.CreateChatCompletion(context.Background(), req)
+			resp, err := m.chatCompletion(req)
+			if err != nil && errors.Is(err, context.Canceled) && len(m.Turn.Steering()) > 0 {
+				slog.Info("Model call interrupted to steer")
+				continue
+			}
 			if err != nil {
 				slog.Error("API call failed", "error", err)
 				return ErrMsg(fmt.Errorf("API error: %v", err))
@@ -136,60 +164,51 @@ func (m Model) InvokeAI() tea.Cmd {
 				}
 				messages = append(messages, assistantMsg)
 
-				// Execute each tool and add results
+				// Execute each tool and add results. Tools the UI runs wait until the rest
+				// of the batch is done, so every call has a result before the next request.
+				var uiCalls []openai.ToolCall
 				for _, toolCall := range choice.Message.ToolCalls {
 					slog.Info("Executing tool", "name", toolCall.Function.Name, "id", toolCall.ID, "args", toolCall.Function.Arguments)
 
-					if toolCall.Function.Name == "run_command" {
-						var args struct {
-							Command string   `json:"command"`
-							Args    []string `json:"args"`
-						}
-						// Use map[string]interface and define struct locally or inside logic
-						if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err == nil {
-							// Trigger part 2 of the "Pulse" pattern
-							return RunCommandMsg{
-								Command:    args.Command,
-								Args:       args.Args,
-								ToolCallID: toolCall.ID,
-								History:    messages,
-							}
-						}
+					// Refuse tools that were not offered in the current mode (e.g. writes in plan mode)
+					if !m.toolAllowed(toolCall.Function.Name) {
+						slog.Warn("Tool not allowed in current mode", "name", toolCall.Function.Name, "planMode", m.PlanMode)
+						result := agent.ErrorResult(fmt.Errorf("%s is not available in the current mode", toolCall.Function.Name))
+						m.ToolLog.Record(toolCall.ID, result)
+						messages = append(messages, openai.ChatCompletionMessage{
+							Role:       openai.ChatMessageRoleTool,
+							Content:    result.ForModel(),
+							ToolCallID: toolCall.ID,
+						})
+						continue
 					}
 
-					// Check if it's the specific "manage_window" tool
-					if toolCall.Function.Name == "manage_window" {
-						var args struct {
-							Action string `json:"action"`
-							Target string `json:"target"`
-						}
-						if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err == nil {
-							return WindowControlMsg{
-								Action:     args.Action,
-								Target:     args.Target,
-								ToolCallID: toolCall.ID,
-								History:    messages,
-							}
-						}
+					if _, ok := uiToolMsg(toolCall, nil); ok {
+						uiCalls = append(uiCalls, toolCall)
+						continue
 					}
 
 					// Execute other tools normally
-					result, err := agent.ExecuteToolByName(toolCall.Function.Name, json.RawMessage(toolCall.Function.Arguments))
-					if err != nil {
-						result = fmt.Sprintf("Error executing tool: %v", err)
-						slog.Error("Tool execution failed", "name", toolCall.Function.Name, "error", err)
+					m.ToolLog.Start(toolCall.ID)
+					result := agent.ExecuteToolByName(toolCall.Function.Name, json.RawMessage(toolCall.Function.Arguments))
+					if result.IsError {
+						slog.Error("Tool execution failed", "name", toolCall.Function.Name, "exitCode", result.ExitCode, "error", result.Summary())
 					} else {
-						slog.Info("Tool executed successfully", "name", toolCall.Function.Name, "resultLength", len(result))
+						slog.Info("Tool executed successfully", "name", toolCall.Function.Name, "resultLength", len(result.Content))
 					}
+					m.ToolLog.Record(toolCall.ID, result)
 
-					// Add tool result to messages
+					// Add tool result to messages, nudging the model if it is stuck in a loop
 					toolMsg := openai.ChatCompletionMessage{
 						Role:       openai.ChatMessageRoleTool,
-						Content:    result,
+						Content:    result.ForModel() + m.loopWarning(messages, toolCall),
 						ToolCallID: toolCall.ID,
 					}
 					messages = append(messages, toolMsg)
 				}
+				if len(uiCalls) > 0 {
+					return ToolBatchMsg{Calls: uiCalls, History: messages}
+				}
 
 				// Continue the loop to send results back to model
 				continue
@@ -210,10 +229,69 @@ func (m Model) InvokeAI() tea.Cmd {
 				History: messages,
 			}
 		}
+	}
+}
+
+// ToolBatchMsg hands the UI the tool calls it runs itself, once every other call of
+// the same model response has its result in History
+type ToolBatchMsg struct {
+	Calls   []openai.ToolCall
+	History []openai.ChatCompletionMessage
+}
+
+// uiToolMsg returns the message that has the UI run a tool call, or false for tools
+// the agent runs itself (and calls whose arguments don't parse, which fail there)
+func uiToolMsg(toolCall openai.ToolCall, history []openai.ChatCompletionMessage) (tea.Msg, bool) {
+	input := json.RawMessage(toolCall.Function.Arguments)
+	switch toolCall.Function.Name {
+	case "run_command":
+		var args struct {
+			Command string   `json:"command"`
+			Args    []string `json:"args"`
+		}
+		if err := json.Unmarshal(input, &args); err == nil {
+			// Trigger part 2 of the "Pulse" pattern
+			return RunCommandMsg{Command: args.Command, Args: args.Args, ToolCallID: toolCall.ID, History: history}, true
+		}
+	case "manage_window":
+		if args, err := agent.ParseManageWindow(input); err == nil {
+			return WindowControlMsg{Input: args, ToolCallID: toolCall.ID, History: history}, true
+		}
+	case "delegate_task":
+		// Sub-agents need the model client, so the UI runs them, one after another
+		if args, err := agent.ParseDelegateTask(input); err == nil {
+			return DelegateTaskMsg{Input: args, ToolCallID: toolCall.ID, History: history}, true
+		}
+	case "update_plan":
+		// The approved plan lives in the UI
+		if args, err := agent.ParseUpdatePlan(input); err == nil {
+			return UpdatePlanMsg{Input: args, ToolCallID: toolCall.ID, History: history}, true
+		}
+	case "todo_write":
+		// The todo list lives in the UI
+		if args, err := agent.ParseTodoWrite(input); err == nil {
+			return TodoWriteMsg{Todos: args.Todos, ToolCallID: toolCall.ID, History: history}, true
+		}
+	}
+	return nil, false
+}
 
-		slog.Warn("Max iterations reached in agentic loop")
-		return ErrMsg(errors.New("max iterations reached - possible infinite loop"))
+// resumeTurn hands the next waiting tool call to the UI, or calls the model again
+// once every tool call of the last response has a result
+func (m *Model) resumeTurn() tea.Cmd {
+	for len(m.PendingTools) > 0 {
+		call := m.PendingTools[0]
+		m.PendingTools = m.PendingTools[1:]
+		if msg, ok := uiToolMsg(call, m.History); ok {
+			return func() tea.Msg { return msg }
+		}
 	}
+	return m.InvokeAI()
+}
+
+// modelName returns the model to call, as configured in .env
+func modelName() string {
+	return os.Getenv("ANTHROPIC_MODEL")
 }
 
 // convertToolsToOpenAI converts our ToolDefinition format to OpenAI's Tool format
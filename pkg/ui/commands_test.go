@@ -0,0 +1,190 @@
+package ui
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bethel-nz/trace/pkg/agent"
+	"github.com/bethel-nz/trace/pkg/config"
+	"github.com/bethel-nz/trace/pkg/provider"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+// fakeModel serves the replies in order and rejects any request in which a tool call
+// has no result, as providers do
+func fakeModel(t *testing.T, replies ...openai.ChatCompletionMessage) *openai.Client {
+	t.Helper()
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if id := missingToolResult(req.Messages); id != "" {
+			t.Errorf("Request sent without a result for tool call %s", id)
+			http.Error(w, `{"error":{"message":"missing tool result"}}`, http.StatusBadRequest)
+			return
+		}
+		if len(replies) == 0 {
+			t.Error("Unexpected model request")
+			http.Error(w, `{"error":{"message":"no more replies"}}`, http.StatusBadRequest)
+			return
+		}
+		reply := replies[0]
+		replies = replies[1:]
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: reply}}})
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("ANTHROPIC_MODEL", "test")
+	return provider.NewClient("key", srv.URL)
+}
+
+// missingToolResult returns a tool call that the messages after it don't answer
+func missingToolResult(messages []openai.ChatCompletionMessage) string {
+	for i, msg := range messages {
+		answered := make(map[string]bool)
+		for _, next := range messages[i+1:] {
+			if next.Role != openai.ChatMessageRoleTool {
+				break
+			}
+			answered[next.ToolCallID] = true
+		}
+		for _, call := range msg.ToolCalls {
+			if !answered[call.ID] {
+				return call.ID
+			}
+		}
+	}
+	return ""
+}
+
+// toolCalls is an assistant reply calling tools, given as id, name and arguments triples
+func toolCalls(calls ...string) openai.ChatCompletionMessage {
+	msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	for i := 0; i+2 < len(calls); i += 3 {
+		msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
+			ID:       calls[i],
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: calls[i+1], Arguments: calls[i+2]},
+		})
+	}
+	return msg
+}
+
+// runTurn runs cmd and the turn's messages through Update until the final response
+func runTurn(t *testing.T, m Model, cmd tea.Cmd) Model {
+	t.Helper()
+	queue := []tea.Cmd{cmd}
+	for steps := 0; len(queue) > 0 && steps < 100; steps++ {
+		cmd, queue = queue[0], queue[1:]
+		if cmd == nil {
+			continue
+		}
+		switch msg := cmd().(type) {
+		case tea.BatchMsg:
+			queue = append(queue, msg...)
+		case AiResponseMsg:
+			next, _ := m.Update(msg)
+			return next.(Model)
+		case ErrMsg:
+			t.Fatalf("Turn failed: %v", msg)
+		case ToolBatchMsg, TodoWriteMsg, UpdatePlanMsg, DelegateTaskMsg, SubagentDoneMsg:
+			next, cmd := m.Update(msg)
+			m = next.(Model)
+			queue = append(queue, cmd)
+		}
+	}
+	t.Fatal("Turn ended without a final response")
+	return m
+}
+
+// toolResults maps each tool call ID in the history to its result
+func toolResults(history []openai.ChatCompletionMessage) map[string]string {
+	results := make(map[string]string)
+	for _, msg := range history {
+		if msg.Role == openai.ChatMessageRoleTool {
+			results[msg.ToolCallID] = msg.Content
+		}
+	}
+	return results
+}
+
+func TestToolBatchWithTodoWrite(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("a.txt", []byte("hello\n"), 0644)
+	client := fakeModel(t,
+		toolCalls(
+			"todo", "todo_write", `{"todos":[{"text":"Read a.txt","status":"in_progress"}]}`,
+			"read", "read_file", `{"path":"a.txt"}`,
+		),
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Done."},
+	)
+	m := InitialModel(client, config.Default(), nil, "")
+
+	m = runTurn(t, m, m.InvokeAI())
+	results := toolResults(m.History)
+	if !strings.Contains(results["read"], "hello") || !strings.Contains(results["todo"], "Todo list updated") {
+		t.Errorf("Expected both calls answered, got %q", results)
+	}
+	if len(m.Todos) != 1 || m.History[len(m.History)-1].Content != "Done." {
+		t.Errorf("Expected the todo list set and the turn finished, got %+v", m.Todos)
+	}
+}
+
+func TestToolBatchWithUpdatePlan(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("b.txt", []byte("next step\n"), 0644)
+	client := fakeModel(t,
+		toolCalls(
+			"tick", "update_plan", `{"step":1,"status":"done"}`,
+			"read", "read_file", `{"path":"b.txt"}`,
+		),
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Step 2 started."},
+	)
+	m := InitialModel(client, config.Default(), nil, "")
+	m.Plan = []agent.PlanItem{{Text: "First", Status: "in_progress"}, {Text: "Second", Status: "pending"}}
+
+	m = runTurn(t, m, m.InvokeAI())
+	results := toolResults(m.History)
+	if !strings.Contains(results["read"], "next step") || results["tick"] == "" {
+		t.Errorf("Expected both calls answered, got %q", results)
+	}
+	if m.Plan[0].Status != "done" {
+		t.Errorf("Expected step 1 done, got %+v", m.Plan)
+	}
+}
+
+func TestToolBatchWithDelegations(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("c.txt", []byte("main\n"), 0644)
+	reply := func(content string) openai.ChatCompletionMessage {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}
+	}
+	client := fakeModel(t,
+		toolCalls(
+			"one", "delegate_task", `{"task":"Explore pkg/a"}`,
+			"two", "delegate_task", `{"task":"Explore pkg/b"}`,
+			"read", "read_file", `{"path":"c.txt"}`,
+		),
+		reply("Summary of a"), // The sub-agents run one after another
+		reply("Summary of b"),
+		reply("Both explored."),
+	)
+	m := InitialModel(client, config.Default(), nil, "")
+
+	m = runTurn(t, m, m.InvokeAI())
+	results := toolResults(m.History)
+	if results["one"] != "Summary of a" || results["two"] != "Summary of b" || !strings.Contains(results["read"], "main") {
+		t.Errorf("Expected every call answered, got %q", results)
+	}
+	if len(m.Subagents) != 2 || m.History[len(m.History)-1].Content != "Both explored." {
+		t.Errorf("Expected both transcripts kept and the turn finished, got %d", len(m.Subagents))
+	}
+}
@@ -0,0 +1,141 @@
+package ui
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// FileMatch is a single autocomplete candidate with the rune positions that matched the query.
+type FileMatch struct {
+	Path      string
+	Score     int
+	Positions []int
+}
+
+// Scoring weights, loosely modelled on fzf's v1 algorithm
+const (
+	scoreMatch        = 16
+	bonusBoundary     = 10 // Match right after '/', '_', '-', '.' or at the start
+	bonusConsecutive  = 8  // Match directly after the previous match
+	bonusCamel        = 6  // Upper case letter following a lower case one
+	bonusBasename     = 4  // Match inside the file name rather than the directory
+	bonusExactCase    = 1
+	penaltyGap        = 2 // Per skipped rune between matches
+	penaltyGapLeading = 1 // Per rune before the first match
+)
+
+// fuzzyMatch checks whether every rune of pattern appears in target in order (case-insensitive)
+// and returns a score and the matched rune positions. Higher scores are better.
+func fuzzyMatch(pattern, target string) (int, []int, bool) {
+	if pattern == "" {
+		return 0, nil, true
+	}
+
+	pat := []rune(pattern)
+	tgt := []rune(target)
+
+	// 1. Find the earliest point where the whole pattern has matched, then walk backwards
+	// to tighten the window. This is the same two-pass trick fzf uses to prefer compact matches.
+	pi := 0
+	end := -1
+	for ti := 0; ti < len(tgt); ti++ {
+		if equalFold(pat[pi], tgt[ti]) {
+			pi++
+			if pi == len(pat) {
+				end = ti
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	pi = len(pat) - 1
+	start := end
+	for ti := end; ti >= 0; ti-- {
+		if equalFold(pat[pi], tgt[ti]) {
+			pi--
+			if pi < 0 {
+				start = ti
+				break
+			}
+		}
+	}
+
+	// 2. Forward pass over the tightened window to collect positions and score them
+	baseStart := strings.LastIndex(target, "/") + 1
+	baseStartRune := len([]rune(target[:baseStart]))
+
+	positions := make([]int, 0, len(pat))
+	score := 0
+	pi = 0
+	prev := -1
+	for ti := start; ti <= end && pi < len(pat); ti++ {
+		if !equalFold(pat[pi], tgt[ti]) {
+			continue
+		}
+		score += scoreMatch
+		if pat[pi] == tgt[ti] {
+			score += bonusExactCase
+		}
+		if ti == 0 || isBoundary(tgt[ti-1]) {
+			score += bonusBoundary
+		} else if unicode.IsUpper(tgt[ti]) && unicode.IsLower(tgt[ti-1]) {
+			score += bonusCamel
+		}
+		if prev >= 0 {
+			if ti == prev+1 {
+				score += bonusConsecutive
+			} else {
+				score -= penaltyGap * (ti - prev - 1)
+			}
+		}
+		if ti >= baseStartRune {
+			score += bonusBasename
+		}
+		positions = append(positions, ti)
+		prev = ti
+		pi++
+	}
+	score -= penaltyGapLeading * start
+
+	return score, positions, true
+}
+
+// fuzzyFilter returns every file matching query, best matches first
+func fuzzyFilter(query string, files []string) []FileMatch {
+	var matches []FileMatch
+	for _, f := range files {
+		score, positions, ok := fuzzyMatch(query, f)
+		if !ok {
+			continue
+		}
+		matches = append(matches, FileMatch{Path: f, Score: score, Positions: positions})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		// Shorter paths first on ties, then alphabetical for stable output
+		if len(matches[i].Path) != len(matches[j].Path) {
+			return len(matches[i].Path) < len(matches[j].Path)
+		}
+		return matches[i].Path < matches[j].Path
+	})
+	return matches
+}
+
+func equalFold(a, b rune) bool {
+	return a == b || unicode.ToLower(a) == unicode.ToLower(b)
+}
+
+func isBoundary(r rune) bool {
+	switch r {
+	case '/', '_', '-', '.', ' ':
+		return true
+	}
+	return false
+}
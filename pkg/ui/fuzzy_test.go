@@ -0,0 +1,35 @@
+package ui
+
+import "testing"
+
+func TestFuzzyMatch(t *testing.T) {
+	// Test Case 1: Subsequence match with positions
+	_, positions, ok := fuzzyMatch("mdl", "pkg/ui/model.go")
+	if !ok {
+		t.Fatal("Expected 'mdl' to match 'pkg/ui/model.go'")
+	}
+	expected := []int{7, 9, 11}
+	for i, p := range expected {
+		if positions[i] != p {
+			t.Errorf("Expected positions %v, got %v", expected, positions)
+			break
+		}
+	}
+
+	// Test Case 2: No match when runes are out of order
+	if _, _, ok := fuzzyMatch("ldm", "pkg/ui/model.go"); ok {
+		t.Error("Expected 'ldm' not to match")
+	}
+
+	// Test Case 3: Basename and boundary matches rank first
+	files := []string{"pkg/ui/update.go", "pkg/agent/tools.go", "README.md"}
+	results := fuzzyFilter("tools", files)
+	if len(results) == 0 || results[0].Path != "pkg/agent/tools.go" {
+		t.Errorf("Expected tools.go to rank first, got %v", results)
+	}
+
+	// Test Case 4: Empty query returns every file
+	if got := fuzzyFilter("", files); len(got) != len(files) {
+		t.Errorf("Expected %d results for empty query, got %d", len(files), len(got))
+	}
+}
@@ -0,0 +1,219 @@
+package ui
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bethel-nz/trace/pkg/config"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --- Input Editor ---
+
+// Pastes longer than this are collapsed into a chip in the input
+const (
+	pasteChipLines = 8
+	pasteChipChars = 800
+)
+
+// Prompts kept in the history file
+const maxPromptHistory = 500
+
+// promptHistoryFile holds sent prompts, one JSON string per line
+const promptHistoryFile = "history.jsonl"
+
+// EditorDoneMsg carries the draft back from $EDITOR
+type EditorDoneMsg struct {
+	Content string
+	Err     error
+}
+
+// Paste is a large paste shown as a chip in the input and expanded when the prompt is sent
+type Paste struct {
+	Chip    string // Placeholder in the input, e.g. "[Pasted #1 +42 lines]"
+	Content string
+}
+
+// pasteInput inserts pasted text, collapsing large pastes into a chip
+func (m *Model) pasteInput(text string) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Count(strings.TrimRight(text, "\n"), "\n") + 1
+	if lines <= pasteChipLines && len(text) <= pasteChipChars {
+		m.Input.InsertString(text)
+		return
+	}
+	chip := fmt.Sprintf("[Pasted #%d +%d lines]", len(m.Pastes)+1, lines)
+	m.Pastes = append(m.Pastes, Paste{Chip: chip, Content: text})
+	m.Input.InsertString(chip)
+}
+
+// expandPastes replaces the chips in the input with the text they stand for.
+// A chip edited by hand no longer matches and is sent as typed.
+func (m *Model) expandPastes(input string) string {
+	for _, paste := range m.Pastes {
+		input = strings.Replace(input, paste.Chip, paste.Content, 1)
+	}
+	return input
+}
+
+// PromptHistory recalls previously sent prompts with up/down, shared across sessions
+type PromptHistory struct {
+	path    string   // File the history is persisted to, empty to keep it in memory
+	entries []string // Oldest first
+	pos     int      // Entry being shown, len(entries) when editing a new draft
+	draft   string   // Input saved when browsing started
+}
+
+// LoadPromptHistory reads the history file; a missing or unreadable file gives an empty
+// history, and an empty path one kept in memory only
+func LoadPromptHistory(path string) *PromptHistory {
+	h := &PromptHistory{path: path}
+	if path != "" {
+		if f, err := os.Open(path); err == nil {
+			scanner := bufio.NewScanner(f)
+			scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+			for scanner.Scan() {
+				var prompt string
+				if json.Unmarshal(scanner.Bytes(), &prompt) == nil && prompt != "" {
+					h.entries = append(h.entries, prompt)
+				}
+			}
+			f.Close()
+		}
+	}
+	if len(h.entries) > maxPromptHistory {
+		h.entries = h.entries[len(h.entries)-maxPromptHistory:]
+	}
+	h.pos = len(h.entries)
+	return h
+}
+
+// DefaultPromptHistoryPath is the history file in the user's Trace directory
+func DefaultPromptHistoryPath() string {
+	if dir := config.UserDir(); dir != "" {
+		return filepath.Join(dir, promptHistoryFile)
+	}
+	return ""
+}
+
+// Add records a sent prompt and stops browsing. Repeating the last prompt is not recorded twice.
+func (h *PromptHistory) Add(prompt string) error {
+	h.pos = len(h.entries)
+	h.draft = ""
+	if strings.TrimSpace(prompt) == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == prompt) {
+		return nil
+	}
+	h.entries = append(h.entries, prompt)
+	if len(h.entries) > maxPromptHistory {
+		h.entries = h.entries[len(h.entries)-maxPromptHistory:]
+	}
+	h.pos = len(h.entries)
+	if h.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+	// Rewrite the file when it has grown past the cap, otherwise append
+	if len(h.entries) == maxPromptHistory {
+		var b strings.Builder
+		for _, entry := range h.entries {
+			line, _ := json.Marshal(entry)
+			b.Write(line)
+			b.WriteByte('\n')
+		}
+		return os.WriteFile(h.path, []byte(b.String()), 0600)
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	line, _ := json.Marshal(prompt)
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Prev returns the previous prompt, saving current as the draft when browsing starts
+func (h *PromptHistory) Prev(current string) (string, bool) {
+	if h.pos == 0 {
+		return "", false
+	}
+	if h.pos == len(h.entries) {
+		h.draft = current
+	}
+	h.pos--
+	return h.entries[h.pos], true
+}
+
+// Next returns the following prompt, or the saved draft after the newest one
+func (h *PromptHistory) Next() (string, bool) {
+	if h.pos >= len(h.entries) {
+		return "", false
+	}
+	h.pos++
+	if h.pos == len(h.entries) {
+		return h.draft, true
+	}
+	return h.entries[h.pos], true
+}
+
+// recallPrompt replaces the input with an older (or newer) prompt.
+// It only applies when the cursor is on the first (or last) line, so arrows still move within a multiline draft.
+func (m *Model) recallPrompt(older bool) bool {
+	var (
+		prompt string
+		ok     bool
+	)
+	switch {
+	case older && m.Input.Line() == 0:
+		prompt, ok = m.Prompts.Prev(m.Input.Value())
+	case !older && m.Input.Line() == m.Input.LineCount()-1:
+		prompt, ok = m.Prompts.Next()
+	}
+	if ok {
+		m.Input.SetValue(prompt)
+	}
+	return ok
+}
+
+// openEditorCmd hands the draft to $VISUAL or $EDITOR and suspends the TUI until it exits
+func openEditorCmd(draft string) tea.Cmd {
+	f, err := os.CreateTemp("", "trace-prompt-*.md")
+	if err != nil {
+		return func() tea.Msg { return EditorDoneMsg{Err: err} }
+	}
+	path := f.Name()
+	_, err = f.WriteString(draft)
+	f.Close()
+	if err != nil {
+		os.Remove(path)
+		return func() tea.Msg { return EditorDoneMsg{Err: err} }
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// EDITOR may carry flags, e.g. "code --wait"
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], path)...)
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		defer os.Remove(path)
+		if err != nil {
+			return EditorDoneMsg{Err: fmt.Errorf("%s: %w", parts[0], err)}
+		}
+		content, err := os.ReadFile(path)
+		return EditorDoneMsg{Content: strings.TrimRight(string(content), "\n"), Err: err}
+	})
+}
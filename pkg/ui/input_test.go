@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bethel-nz/trace/pkg/config"
+)
+
+func TestPromptHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace", promptHistoryFile)
+	h := LoadPromptHistory(path)
+	for _, prompt := range []string{"first", "second\nwith two lines", "second\nwith two lines", "third"} {
+		if err := h.Add(prompt); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	// A new session sees the same prompts, without the repeated one
+	h = LoadPromptHistory(path)
+	if len(h.entries) != 3 || h.entries[1] != "second\nwith two lines" {
+		t.Fatalf("Expected 3 persisted prompts, got %q", h.entries)
+	}
+
+	if prompt, _ := h.Prev("draft"); prompt != "third" {
+		t.Errorf("Expected third, got %q", prompt)
+	}
+	h.Prev("")
+	if prompt, _ := h.Prev(""); prompt != "first" {
+		t.Errorf("Expected first, got %q", prompt)
+	}
+	if _, ok := h.Prev(""); ok {
+		t.Error("Expected no prompt before the oldest")
+	}
+	h.Next()
+	h.Next()
+	if prompt, _ := h.Next(); prompt != "draft" {
+		t.Errorf("Expected the draft back after the newest prompt, got %q", prompt)
+	}
+}
+
+func TestPasteChips(t *testing.T) {
+	m := InitialModel(nil, config.Default(), nil, "")
+
+	m.pasteInput("short")
+	big := strings.Repeat("line\n", 20)
+	m.pasteInput(big)
+	if len(m.Pastes) != 1 || m.Input.Value() != "short[Pasted #1 +20 lines]" {
+		t.Fatalf("Expected a chip for the large paste, got %q", m.Input.Value())
+	}
+	if got := m.expandPastes(m.Input.Value()); got != "short"+big {
+		t.Errorf("Expected the chip expanded on send, got %q", got)
+	}
+
+	// Up on the first line recalls, down on the last line returns to the draft
+	m.Prompts.Add("earlier")
+	m.Input.SetValue("draft")
+	if !m.recallPrompt(true) || m.Input.Value() != "earlier" {
+		t.Errorf("Expected the earlier prompt, got %q", m.Input.Value())
+	}
+	if !m.recallPrompt(false) || m.Input.Value() != "draft" {
+		t.Errorf("Expected the draft, got %q", m.Input.Value())
+	}
+}
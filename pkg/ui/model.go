@@ -1,6 +1,12 @@
 package ui
 
 import (
+	"github.com/bethel-nz/trace/pkg/agent"
+	"github.com/bethel-nz/trace/pkg/checkpoint"
+	"github.com/bethel-nz/trace/pkg/config"
+	"github.com/bethel-nz/trace/pkg/provider"
+	"github.com/bethel-nz/trace/pkg/worktree"
+
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/viewport"
@@ -14,20 +20,29 @@ type SessionState int
 const (
 	StateIdle SessionState = iota
 	StateThinking
+	StateConfirmContinue // Iteration budget reached, waiting for y/n
 )
 
 type ErrMsg error
 
+// FilesRefreshedMsg carries a fresh listing of project files for autocomplete
+type FilesRefreshedMsg []string
+
 type WindowControlMsg struct {
-	Action     string
-	Target     string
+	Input      agent.ManageWindowInput
 	ToolCallID string
 	History    []openai.ChatCompletionMessage
 }
 
 type Model struct {
-	Client *openai.Client
-	State  SessionState
+	Client   *openai.Client
+	Fallback *provider.Target // Secondary model used after repeated provider failures, may be nil
+	Config   config.Config
+	State    SessionState
+
+	// Extra iterations granted for the current turn after hitting the budget
+	ExtraIterations int
+	TurnStart       int // History index of the user message that started the current turn
 
 	// UI Components
 	Viewport     viewport.Model
@@ -39,26 +54,80 @@ type Model struct {
 	Files    []string // All files in repo
 	Filtered []string // For autocomplete
 
+	BasePrompt   string                         // System prompt before TRACE.md memory is merged in
 	History      []openai.ChatCompletionMessage // Conversation history
-	PendingQueue []string                       // User messages waiting to be sent
+	PendingQueue []string                       // User messages waiting to be sent, added to History when sent
+	QueueEdit    int                            // 1-based queue position of the message being edited, 0 when none
+	Turn         *TurnControl                   // Interrupts the running turn to steer it
+	PendingTools []openai.ToolCall              // Tool calls of the last response waiting for the UI to run them
+
+	// Conversation branches, forked by editing an earlier user message
+	Session        *Session
+	EditingMessage int // 1-based history index of the user message being edited, 0 when none
+
+	// Working tree checkpoints taken at the start of each turn, for /rewind
+	Snapshots          *checkpoint.Store // Nil disables checkpoints
+	Checkpoints        []TurnCheckpoint
+	pendingCheckpoints []TurnCheckpoint // Turns waiting for their snapshot, taken by startTurn
+
+	// Isolated git worktree the session runs in (--worktree), nil when running in the user's checkout
+	Worktree        *worktree.Worktree
+	WorktreeChanges string // Diffstat shown while asking what to do with the worktree on exit
+	ExitMessage     string // Printed after the TUI closes
+
+	// Input editor
+	Prompts *PromptHistory // Sent prompts, recalled with up/down
+	Pastes  []Paste        // Large pastes collapsed into chips in the current draft
+
+	// Plan mode
+	PlanMode     bool             // Read-only tools; the agent must end with a numbered plan
+	ProposedPlan []agent.PlanItem // Plan from the last plan-mode reply, waiting for /approve
+	Plan         []agent.PlanItem // Approved plan, ticked off via update_plan
+
+	// Todo list written by the agent, shown in the sidebar
+	Todos []agent.PlanItem
+
+	// Sub-agent transcripts keyed by the delegate_task tool call ID
+	Subagents map[string][]openai.ChatCompletionMessage
+
+	// Tool cards in the chat, keyed by tool call ID
+	ToolLog       *ToolLog        // Results and timings of tool calls made this session
+	ExpandedCards map[string]bool // Cards toggled open with ctrl+o
+	ExpandAll     bool            // Every card open (ctrl+o with no card selected)
+	SelectedCard  string          // Card or user message ("msg:<index>") picked with alt+up/alt+down, empty when none
+	cardIDs       []string        // Cards and user messages in render order
+	cardLines     []int           // Line in the chat content where each one starts
 
 	ProcessChan   chan tea.Msg // Channel for live process logs
 	ProcessOutput string       // Accumulator for current process output
+	ProcessTab    string       // ID of the sidebar tab receiving the running process's output
+
+	StatusChan chan tea.Msg   // Retry notices from background model calls
+	Retry      RetryStatusMsg // Retry in progress, zero when none
 
 	// Autocomplete state
-	ShowAutocomplete bool
-	AutocompleteIdx  int
-	AutocompleteList []string
+	ShowAutocomplete   bool
+	AutocompleteIdx    int
+	AutocompleteOffset int // First visible row when the list is longer than autocompleteHeight
+	AutocompleteList   []FileMatch
+
+	// Status holds a short notice from slash commands, shown above the input
+	Status string
 
 	// Layout dimensions
 	Width, Height int
 	ShowSidebar   bool // Toggle for Right Sidebar
+
+	// Sidebar tabs and keyboard focus
+	Tabs      []SidebarTab
+	ActiveTab int
+	Focus     FocusArea // Pane receiving scroll keys; tab cycles it
 }
 
-func InitialModel(client *openai.Client, files []string, systemPrompt string) Model {
+func InitialModel(client *openai.Client, cfg config.Config, files []string, systemPrompt string) Model {
 	// Input area setup
 	ta := textarea.New()
-	ta.Placeholder = "Ask Trace... (Type @ to tag files)"
+	ta.Placeholder = "Ask Trace... (Type @ to tag files, alt+enter for a new line, ctrl+g for $EDITOR)"
 	ta.Focus()
 	ta.Prompt = "| "
 	ta.CharLimit = 0
@@ -83,34 +152,47 @@ func InitialModel(client *openai.Client, files []string, systemPrompt string) Mo
 	if systemPrompt != "" {
 		initialHistory = append(initialHistory, openai.ChatCompletionMessage{
 			Role:    "system",
-			Content: systemPrompt,
+			Content: agent.WithMemory(systemPrompt),
 		})
 		initialHistory = append(initialHistory, openai.ChatCompletionMessage{
 			Role:    "user",
 			Content: "Hello! Please introduce yourself and your tools briefly.",
 		})
 	}
-	ta.KeyMap.InsertNewline.SetEnabled(false)
-
-	return Model{
-		Client:       client,
-		State:        StateIdle,
-		Viewport:     vp,
-		SideViewport: svp,
-		Input:        ta,
-		Spinner:      s,
-		Files:        files,
-		Filtered:     []string{},
-		History:      initialHistory,
-		PendingQueue: []string{},
-		ProcessChan:  make(chan tea.Msg),
+	// Enter sends; alt+enter (or ctrl+j, which many terminals send for shift+enter) adds a line
+	ta.KeyMap.InsertNewline.SetKeys("alt+enter", "ctrl+j")
+
+	m := Model{
+		Client:        client,
+		Config:        cfg,
+		State:         StateIdle,
+		Viewport:      vp,
+		SideViewport:  svp,
+		Input:         ta,
+		Spinner:       s,
+		Files:         files,
+		BasePrompt:    systemPrompt,
+		Filtered:      []string{},
+		History:       initialHistory,
+		PendingQueue:  []string{},
+		Prompts:       LoadPromptHistory(""), // In memory until main loads the user's history
+		Turn:          newTurnControl(),
+		Session:       newSession("", initialHistory), // Not saved until main sets the path
+		Subagents:     make(map[string][]openai.ChatCompletionMessage),
+		ToolLog:       newToolLog(),
+		ExpandedCards: make(map[string]bool),
+		ProcessChan:   make(chan tea.Msg),
+		StatusChan:    make(chan tea.Msg, 16),
 	}
+	m.Fallback = newFallbackTarget(m)
+	return m
 }
 
 func (m Model) Init() tea.Cmd {
 	return tea.Batch(
 		textarea.Blink,
 		m.Spinner.Tick,
+		WaitForStatus(m.StatusChan),
 		m.InvokeAI(), // Trigger the API call
 	)
 }
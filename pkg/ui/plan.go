@@ -0,0 +1,147 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bethel-nz/trace/pkg/agent"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Plan Mode ---
+
+// UpdatePlanMsg asks the UI to update a step of the approved plan
+type UpdatePlanMsg struct {
+	Input      agent.UpdatePlanInput
+	ToolCallID string
+	History    []openai.ChatCompletionMessage
+}
+
+// TodoWriteMsg asks the UI to replace the todo list
+type TodoWriteMsg struct {
+	Todos      []agent.PlanItem
+	ToolCallID string
+	History    []openai.ChatCompletionMessage
+}
+
+// availableTools returns the tools the model may use in the current mode
+func (m Model) availableTools() []agent.ToolDefinition {
+	var defs []agent.ToolDefinition
+	for _, def := range agent.GetAllToolDefinitions() {
+		// Plan mode is strictly read-only
+		if m.PlanMode && !def.ReadOnly {
+			continue
+		}
+		// Nothing to tick off without an approved plan
+		if def.Name == "update_plan" && len(m.Plan) == 0 {
+			continue
+		}
+		defs = append(defs, def)
+	}
+	return defs
+}
+
+// toolAllowed guards against models calling tools they were not offered
+func (m Model) toolAllowed(name string) bool {
+	for _, def := range m.availableTools() {
+		if def.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// requestMessages adds mode instructions to the messages sent to the model without
+// storing them in the history
+func (m Model) requestMessages(messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	if !m.PlanMode {
+		return messages
+	}
+	req := make([]openai.ChatCompletionMessage, len(messages), len(messages)+1)
+	copy(req, messages)
+	return append(req, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: agent.PlanModeInstruction,
+	})
+}
+
+func (m *Model) togglePlanMode() {
+	m.PlanMode = !m.PlanMode
+	if m.PlanMode {
+		m.Status = "Plan mode: read-only tools, the agent will propose a plan (shift+tab to exit)"
+	} else {
+		m.ProposedPlan = nil
+		m.Status = "Plan mode off"
+	}
+}
+
+// capturePlan records the numbered plan from the last reply while in plan mode
+func (m *Model) capturePlan() {
+	if !m.PlanMode || len(m.History) == 0 {
+		return
+	}
+	last := m.History[len(m.History)-1]
+	if last.Role != openai.ChatMessageRoleAssistant {
+		return
+	}
+	if items := agent.ParsePlan(last.Content); len(items) > 0 {
+		m.ProposedPlan = items
+		m.Status = fmt.Sprintf("Plan ready (%d steps): /approve to execute, or reply to refine it", len(items))
+	}
+}
+
+// approvePlan switches to execution mode and asks the agent to carry out the plan
+func (m *Model) approvePlan() tea.Cmd {
+	if len(m.ProposedPlan) == 0 {
+		m.Status = "No plan to approve. Use shift+tab to enter plan mode first."
+		return nil
+	}
+	if m.State != StateIdle {
+		m.Status = "Wait for the current turn to finish before approving."
+		return nil
+	}
+
+	m.Plan = m.ProposedPlan
+	m.ProposedPlan = nil
+	m.PlanMode = false
+	m.Status = ""
+
+	m.beginTurn()
+	m.History = append(m.History, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: agent.PlanApprovedMessage + "\n\n" + agent.FormatChecklist(m.Plan),
+	})
+	m.State = StateThinking
+	return m.InvokeAI()
+}
+
+// applyPlanUpdate updates a step and returns the tool result for the model
+func (m *Model) applyPlanUpdate(input agent.UpdatePlanInput) agent.ToolResult {
+	if input.Step > len(m.Plan) {
+		return agent.ErrorResult(fmt.Errorf("step %d does not exist, the plan has %d steps", input.Step, len(m.Plan)))
+	}
+	m.Plan[input.Step-1].Status = input.Status
+	return agent.ToolResult{Content: fmt.Sprintf("Step %d marked %s.\n\n%s", input.Step, input.Status, agent.FormatChecklist(m.Plan))}
+}
+
+// renderChecklist renders plan or todo items with status icons
+func renderChecklist(title string, items []agent.PlanItem) string {
+	var b strings.Builder
+	b.WriteString(traceStyle.Render(title) + "\n")
+	for i, item := range items {
+		line := fmt.Sprintf("%d. %s", i+1, item.Text)
+		switch item.Status {
+		case agent.StatusDone:
+			b.WriteString(checkDone.Render("✓ "+line) + "\n")
+		case agent.StatusInProgress:
+			b.WriteString(checkActive.Render("▶ "+line) + "\n")
+		case agent.StatusSkipped:
+			b.WriteString(mutedStyle.Render("– "+line) + "\n")
+		default:
+			b.WriteString(checkPending.Render("○ "+line) + "\n")
+		}
+	}
+	return b.String()
+}
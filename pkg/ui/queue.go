@@ -0,0 +1,199 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Message Queue & Steering ---
+
+// TurnControl lets the UI interrupt the running turn's model calls and processes.
+// It is shared by pointer because commands run on copies of the Model.
+type TurnControl struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	steer  []string // Messages for the agentic loop to pick up before its next model call
+}
+
+func newTurnControl() *TurnControl {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &TurnControl{ctx: ctx, cancel: cancel}
+}
+
+// Context is cancelled when the user interrupts the turn
+func (t *TurnControl) Context() context.Context {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ctx
+}
+
+// Interrupt cancels the in-flight model call or process and hands message to the loop as steering
+func (t *TurnControl) Interrupt(message string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.steer = append(t.steer, message)
+	t.cancel()
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+}
+
+// Cancel stops the in-flight model call or process without steering the turn
+func (t *TurnControl) Cancel() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cancel()
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+}
+
+// TakeSteering returns the steering messages not yet sent and clears them
+func (t *TurnControl) TakeSteering() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	steer := t.steer
+	t.steer = nil
+	return steer
+}
+
+// Steering returns the steering messages not yet sent
+func (t *TurnControl) Steering() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.steer...)
+}
+
+// appendUserMessage adds a message to the history as it is sent, resolving @file tags.
+// Each message starts a turn, so the working tree is checkpointed first.
+func (m *Model) appendUserMessage(text string) {
+	m.checkpointTurn(text)
+	m.History = append(m.History, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: m.resolveFileTags(text),
+	})
+}
+
+// sendNext starts a turn with steering left over from the last turn, or else the first queued message
+func (m *Model) sendNext() tea.Cmd {
+	if steer := m.Turn.TakeSteering(); len(steer) > 0 {
+		m.beginTurn()
+		for _, text := range steer {
+			m.appendUserMessage(text)
+		}
+	} else if len(m.PendingQueue) > 0 {
+		m.beginTurn()
+		m.appendUserMessage(m.PendingQueue[0])
+		m.PendingQueue = m.PendingQueue[1:]
+	} else {
+		return nil
+	}
+	m.State = StateThinking
+	return m.startTurn()
+}
+
+// queueMessage holds a message until the running turn ends.
+// A message being edited with /queue edit goes back to its old position.
+func (m *Model) queueMessage(text string) {
+	pos := len(m.PendingQueue)
+	if m.QueueEdit > 0 {
+		pos = min(m.QueueEdit-1, len(m.PendingQueue))
+	}
+	m.PendingQueue = append(m.PendingQueue[:pos], append([]string{text}, m.PendingQueue[pos:]...)...)
+	m.QueueEdit = 0
+}
+
+// /queue                -> list the queue commands
+// /queue edit|rm <n>    -> move a queued message into the input, or drop it
+// /queue up|down <n>    -> reorder
+// /queue clear          -> drop everything
+func (m *Model) queueCommand(args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		if len(m.PendingQueue) == 0 {
+			m.Status = "The queue is empty"
+		} else {
+			m.Status = fmt.Sprintf("%d queued · /queue edit|rm|up|down <n> · /queue clear · /steer [n]", len(m.PendingQueue))
+		}
+		return
+	}
+	if fields[0] == "clear" {
+		m.PendingQueue = nil
+		m.Status = "Queue cleared"
+		return
+	}
+
+	i, ok := m.queueIndex(fields[1:])
+	if !ok {
+		m.Status = "Usage: /queue edit|rm|up|down <n>"
+		return
+	}
+	switch fields[0] {
+	case "edit":
+		m.Input.SetValue(m.PendingQueue[i])
+		m.PendingQueue = append(m.PendingQueue[:i], m.PendingQueue[i+1:]...)
+		m.QueueEdit = i + 1
+		m.Status = fmt.Sprintf("Editing queued #%d; enter puts it back", i+1)
+		return
+	case "rm":
+		m.PendingQueue = append(m.PendingQueue[:i], m.PendingQueue[i+1:]...)
+		m.Status = fmt.Sprintf("Removed queued #%d", i+1)
+	case "up":
+		if i > 0 {
+			m.PendingQueue[i-1], m.PendingQueue[i] = m.PendingQueue[i], m.PendingQueue[i-1]
+		}
+		m.Status = ""
+	case "down":
+		if i < len(m.PendingQueue)-1 {
+			m.PendingQueue[i], m.PendingQueue[i+1] = m.PendingQueue[i+1], m.PendingQueue[i]
+		}
+		m.Status = ""
+	default:
+		m.Status = "Usage: /queue edit|rm|up|down <n>"
+	}
+}
+
+// queueIndex parses a 1-based queue position
+func (m *Model) queueIndex(args []string) (int, bool) {
+	if len(args) != 1 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(m.PendingQueue) {
+		return 0, false
+	}
+	return n - 1, true
+}
+
+// /steer [n]    -> interrupt the turn and send queued message n (default 1) now
+// /steer <text> -> interrupt the turn and send text now
+func (m *Model) steerCommand(arg string) tea.Cmd {
+	text := arg
+	if _, err := strconv.Atoi(arg); err == nil || arg == "" {
+		if arg == "" {
+			arg = "1"
+		}
+		i, ok := m.queueIndex([]string{arg})
+		if !ok {
+			m.Status = "Usage: /steer [n] or /steer <message>"
+			return nil
+		}
+		text = m.PendingQueue[i]
+		m.PendingQueue = append(m.PendingQueue[:i], m.PendingQueue[i+1:]...)
+	}
+
+	if m.State == StateIdle {
+		// Nothing to interrupt: send it as a normal message
+		m.beginTurn()
+		m.appendUserMessage(text)
+		m.State = StateThinking
+		m.Status = ""
+		return m.startTurn()
+	}
+	m.Turn.Interrupt(text)
+	m.Status = "Interrupting the current step to steer…"
+	return nil
+}
@@ -0,0 +1,69 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/bethel-nz/trace/pkg/config"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func send(t *testing.T, m Model, text string) Model {
+	t.Helper()
+	m.Input.SetValue(text)
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	return next.(Model)
+}
+
+func TestMessageQueue(t *testing.T) {
+	m := InitialModel(nil, config.Default(), nil, "")
+	m.State = StateThinking
+
+	// Messages typed while busy wait in the queue, not the history
+	for _, text := range []string{"one", "two", "three"} {
+		m = send(t, m, text)
+	}
+	if len(m.History) != 0 || len(m.PendingQueue) != 3 {
+		t.Fatalf("Expected 3 queued and no history, got %d queued, %d in history", len(m.PendingQueue), len(m.History))
+	}
+
+	m = send(t, m, "/queue up 3")
+	m = send(t, m, "/queue rm 1")
+	if got := m.PendingQueue; len(got) != 2 || got[0] != "three" || got[1] != "two" {
+		t.Fatalf("Expected [three two], got %q", got)
+	}
+
+	// Editing takes the message out and puts it back in the same place
+	m = send(t, m, "/queue edit 1")
+	if m.Input.Value() != "three" || len(m.PendingQueue) != 1 {
+		t.Fatalf("Expected the message in the input, got %q", m.Input.Value())
+	}
+	m = send(t, m, "three, edited")
+	if m.PendingQueue[0] != "three, edited" || m.QueueEdit != 0 {
+		t.Errorf("Expected the edit back at #1, got %q", m.PendingQueue)
+	}
+
+	// Each message joins the history exactly once, when it is sent
+	next, _ := m.Update(AiCompleteMsg{})
+	m = next.(Model)
+	if len(m.History) != 1 || m.History[0].Content != "three, edited" || len(m.PendingQueue) != 1 {
+		t.Errorf("Expected one message sent, got history %+v, queue %q", m.History, m.PendingQueue)
+	}
+
+	// Steering interrupts the turn and is picked up before anything queued
+	running := m.Turn.Context()
+	m = send(t, m, "/steer 1")
+	if running.Err() == nil {
+		t.Error("Expected the running turn to be cancelled")
+	}
+	if len(m.PendingQueue) != 0 || len(m.Turn.Steering()) != 1 {
+		t.Fatalf("Expected the queued message handed to the turn, got queue %q", m.PendingQueue)
+	}
+	if m.Turn.Context().Err() != nil {
+		t.Error("Expected a fresh context after the interrupt")
+	}
+	next, _ = m.Update(AiCompleteMsg{})
+	m = next.(Model)
+	if len(m.History) != 2 || m.History[1].Content != "two" || len(m.Turn.Steering()) != 0 {
+		t.Errorf("Expected the steering message sent, got %+v", m.History)
+	}
+}
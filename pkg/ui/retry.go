@@ -0,0 +1,73 @@
+package ui
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bethel-nz/trace/pkg/provider"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Provider Retries ---
+
+// RetryStatusMsg reports a retry in progress so the status area can show a countdown
+type RetryStatusMsg struct {
+	Event provider.RetryEvent
+	Until time.Time // When the next attempt starts
+}
+
+// completionFunc makes one model call; sub-agents receive it so they share the retry layer
+type completionFunc func(openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+
+// WaitForStatus listens for the next status update from background model calls
+func WaitForStatus(sub chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-sub
+	}
+}
+
+// newFallbackTarget builds the fallback model from config, if one is configured
+func newFallbackTarget(m Model) *provider.Target {
+	if m.Config.Fallback == nil {
+		return nil
+	}
+	target, err := provider.NewTarget("fallback", *m.Config.Fallback)
+	if err != nil {
+		slog.Warn("Fallback model disabled", "error", err)
+		return nil
+	}
+	return target
+}
+
+// chatCompletion calls the model through the retry layer, publishing retries to StatusChan
+func (m Model) chatCompletion(req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	primary := provider.Target{Name: "primary", Client: m.Client, Model: req.Model}
+	policy := provider.PolicyFromConfig(m.Config.Retry)
+
+	return provider.CreateChatCompletion(m.Turn.Context(), primary, m.Fallback, policy, req, func(event provider.RetryEvent) {
+		msg := RetryStatusMsg{Event: event, Until: time.Now().Add(event.Wait)}
+		// Never block the model call on a busy UI; a missed countdown update is harmless
+		select {
+		case m.StatusChan <- msg:
+		default:
+		}
+	})
+}
+
+// retryStatus renders the countdown shown while a model call is being retried
+func (m Model) retryStatus() string {
+	event := m.Retry.Event
+	if event.Fallback {
+		return fmt.Sprintf("Primary model keeps failing — switched to fallback model (%s)", m.Fallback.Model)
+	}
+	wait := max(time.Until(m.Retry.Until).Round(time.Second), 0)
+	reason := event.Reason
+	if reason != "" {
+		reason = strings.ToUpper(reason[:1]) + reason[1:]
+	}
+	return fmt.Sprintf("%s — retrying in %v (attempt %d/%d)", reason, wait, event.Attempt+1, event.MaxAttempts)
+}
@@ -0,0 +1,156 @@
+package ui
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/bethel-nz/trace/pkg/checkpoint"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --- Checkpoints & Rewind ---
+
+// TurnCheckpoint ties a working tree checkpoint to the conversation at that point
+type TurnCheckpoint struct {
+	checkpoint.Checkpoint
+	Branch     int // Session branch the turn was on
+	HistoryLen int // Messages before the user message that started the turn
+}
+
+// CheckpointMsg delivers the checkpoints taken in the background at the start of a turn
+type CheckpointMsg struct {
+	Checkpoints []TurnCheckpoint
+	Err         error
+}
+
+// checkpointTurn marks the working tree to be snapshotted before a user message is sent.
+// The snapshot runs in startTurn, since git can take a while on a large tree.
+func (m *Model) checkpointTurn(text string) {
+	if m.Snapshots == nil {
+		return
+	}
+	m.pendingCheckpoints = append(m.pendingCheckpoints, TurnCheckpoint{
+		Checkpoint: checkpoint.Checkpoint{Label: truncate(text, 60)},
+		Branch:     m.Session.Current,
+		HistoryLen: len(m.History),
+	})
+}
+
+// startTurn calls the model once the pending checkpoints are taken, so no tool
+// changes a file before the snapshot of its turn exists
+func (m *Model) startTurn() tea.Cmd {
+	return tea.Sequence(m.takeCheckpoints(), m.InvokeAI())
+}
+
+// takeCheckpoints snapshots the working tree for the pending turns off the UI goroutine
+func (m *Model) takeCheckpoints() tea.Cmd {
+	pending := m.pendingCheckpoints
+	m.pendingCheckpoints = nil
+	if len(pending) == 0 {
+		return nil
+	}
+	store := m.Snapshots
+	return func() tea.Msg {
+		var taken []TurnCheckpoint
+		for _, tc := range pending {
+			cp, err := store.Create(tc.Label)
+			if err != nil {
+				return CheckpointMsg{Checkpoints: taken, Err: err}
+			}
+			tc.Checkpoint = cp
+			taken = append(taken, tc)
+		}
+		return CheckpointMsg{Checkpoints: taken}
+	}
+}
+
+// addCheckpoints records the checkpoints taken for a turn
+func (m *Model) addCheckpoints(msg CheckpointMsg) {
+	m.Checkpoints = append(m.Checkpoints, msg.Checkpoints...)
+	if msg.Err != nil {
+		slog.Warn("Checkpoint failed", "error", msg.Err)
+		m.Status = fmt.Sprintf("Checkpoint failed: %v", msg.Err)
+	}
+}
+
+// closeSnapshots drops the session's checkpoints when it ends
+func (m *Model) closeSnapshots() {
+	if m.Snapshots == nil {
+		return
+	}
+	if err := m.Snapshots.Close(); err != nil {
+		slog.Warn("Removing checkpoints failed", "error", err)
+	}
+	m.Checkpoints = nil
+}
+
+// /rewind     -> list the checkpoints in the sidebar
+// /rewind <n> -> restore the files and the conversation to the start of turn n
+func (m *Model) rewindCommand(arg string) tea.Cmd {
+	if m.Snapshots == nil {
+		m.Status = "Checkpoints are disabled"
+		return nil
+	}
+	if arg == "" {
+		m.openTab(SidebarTab{ID: "checkpoints", Title: "checkpoints", Kind: tabText, Output: m.renderCheckpoints()})
+		return m.resizeCmd()
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(m.Checkpoints) {
+		m.Status = fmt.Sprintf("Usage: /rewind <1-%d>", len(m.Checkpoints))
+		return nil
+	}
+	if m.State != StateIdle {
+		m.Status = "Wait for the current turn to finish before rewinding"
+		return nil
+	}
+	if err := m.rewind(n); err != nil {
+		m.Status = fmt.Sprintf("Rewind failed: %v", err)
+		return nil
+	}
+	return RefreshFilesCmd()
+}
+
+// rewind restores checkpoint n. The conversation is rewound on a new branch,
+// so the abandoned turns stay available with /branch.
+func (m *Model) rewind(n int) error {
+	cp := m.Checkpoints[n-1]
+	if err := m.Snapshots.Restore(cp.ID); err != nil {
+		return err
+	}
+	m.Checkpoints = m.Checkpoints[:n-1]
+
+	if cp.Branch != m.Session.Current {
+		m.switchBranch(cp.Branch)
+	}
+	prompt := ""
+	if cp.HistoryLen < len(m.History) {
+		prompt = fileHintRe.ReplaceAllString(m.History[cp.HistoryLen].Content, "")
+	}
+	m.forkBranch(min(cp.HistoryLen, len(m.History)), "rewind: "+cp.Label)
+	m.saveBranches()
+
+	// Offer the prompt of the rewound turn again, to edit or resend
+	m.Input.SetValue(prompt)
+	m.Status = fmt.Sprintf("Rewound files and conversation to checkpoint %d (%s)", n, cp.Created.Format("15:04:05"))
+	m.RenderChat()
+	m.Viewport.GotoBottom()
+	return nil
+}
+
+// renderCheckpoints lists the checkpoints for the sidebar
+func (m *Model) renderCheckpoints() string {
+	if len(m.Checkpoints) == 0 {
+		return mutedStyle.UnsetMarginLeft().Render("No checkpoints yet. One is taken at the start of each turn.")
+	}
+	var b strings.Builder
+	for i, cp := range m.Checkpoints {
+		fmt.Fprintf(&b, "%d. %s  %s\n", i+1, paneGutter.Render(cp.Created.Format("15:04:05")), cp.Label)
+	}
+	b.WriteString("\n" + mutedStyle.UnsetMarginLeft().Render("/rewind <n> restores the files and conversation to the start of turn n"))
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bethel-nz/trace/pkg/checkpoint"
+	"github.com/bethel-nz/trace/pkg/config"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestRewind(t *testing.T) {
+	dir := t.TempDir()
+	// Keep git from finding a repository above the temp dir, so the file backups are tested
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+	path := filepath.Join(dir, "a.txt")
+	os.WriteFile(path, []byte("before"), 0644)
+
+	m := InitialModel(nil, config.Default(), nil, "")
+	m.Snapshots = checkpoint.NewStore(dir)
+
+	m.appendUserMessage("change a.txt")
+	if len(m.Checkpoints) != 0 {
+		t.Fatal("Expected the snapshot to wait for the turn to start")
+	}
+	m.addCheckpoints(m.takeCheckpoints()().(CheckpointMsg))
+	m.Snapshots.Track(path)
+	os.WriteFile(path, []byte("after"), 0644)
+	m.History = append(m.History, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Changed."})
+	m.appendUserMessage("thanks")
+	m.addCheckpoints(m.takeCheckpoints()().(CheckpointMsg))
+	if len(m.Checkpoints) != 2 || m.Checkpoints[1].HistoryLen != 2 {
+		t.Fatalf("Expected a checkpoint per turn, got %+v", m.Checkpoints)
+	}
+
+	if err := m.rewind(1); err != nil {
+		t.Fatalf("rewind failed: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "before" {
+		t.Errorf("Expected the file restored, got %q", got)
+	}
+	if len(m.History) != 0 || m.Input.Value() != "change a.txt" {
+		t.Errorf("Expected the conversation rewound with the prompt offered again, got %d messages, input %q", len(m.History), m.Input.Value())
+	}
+	// The abandoned turns are kept on the original branch
+	if len(m.Session.Branches) != 2 || len(m.Session.Branches[0].Messages) != 3 || len(m.Checkpoints) != 0 {
+		t.Errorf("Expected the old turns kept on branch 1, got %+v", m.Session.Branches)
+	}
+}
@@ -0,0 +1,213 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bethel-nz/trace/pkg/agent"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --- Sidebar File & Diff Views ---
+
+// Largest file the sidebar will highlight
+const maxPaneFileSize = 1024 * 1024
+
+// FilePane is a syntax-highlighted file or diff shown in a sidebar tab
+type FilePane struct {
+	Kind    string   // agent.WindowFile or agent.WindowDiff
+	Path    string   // File shown, or the path a diff is limited to
+	Lines   []string // Highlighted lines
+	Plain   []string // Unstyled lines, for search
+	Line    int      // Highlighted 1-based line, 0 for none
+	Query   string   // Current search
+	Matches []int    // 0-based lines matching Query
+	Match   int      // Index into Matches of the current match
+}
+
+// loadFilePane reads and highlights a file for the sidebar
+func loadFilePane(path string) (FilePane, error) {
+	if strings.HasSuffix(path, ".env") {
+		return FilePane{}, fmt.Errorf("access denied: .env files are protected")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return FilePane{}, err
+	}
+	if info.IsDir() {
+		return FilePane{}, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxPaneFileSize {
+		return FilePane{}, fmt.Errorf("%s is too large to display (>1MB)", path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return FilePane{}, err
+	}
+	if !utf8.Valid(content) {
+		return FilePane{}, fmt.Errorf("%s appears to be binary", path)
+	}
+
+	lexer := lexers.Match(path)
+	if lexer == nil {
+		lexer = lexers.Analyse(string(content))
+	}
+	return newPane(agent.WindowFile, path, string(content), lexer), nil
+}
+
+// loadDiffPane shows uncommitted changes, optionally limited to one path
+func loadDiffPane(path string) (FilePane, error) {
+	args := []string{"diff", "HEAD"}
+	if path != "" {
+		args = append(args, "--", path)
+	}
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		// No commits yet: fall back to unstaged changes
+		args[1] = "--no-ext-diff"
+		if out, err = exec.Command("git", args...).CombinedOutput(); err != nil {
+			return FilePane{}, fmt.Errorf("git diff failed: %s", strings.TrimSpace(string(out)))
+		}
+	}
+	diff := string(out)
+	if strings.TrimSpace(diff) == "" {
+		diff = "No uncommitted changes.\n"
+	}
+	return newPane(agent.WindowDiff, path, diff, lexers.Get("diff")), nil
+}
+
+func newPane(kind, path, content string, lexer chroma.Lexer) FilePane {
+	content = strings.TrimSuffix(strings.ReplaceAll(content, "\t", "    "), "\n")
+	return FilePane{
+		Kind:  kind,
+		Path:  path,
+		Lines: highlightLines(content, lexer),
+		Plain: strings.Split(content, "\n"),
+	}
+}
+
+// highlightLines highlights content with chroma, one string per source line so
+// line numbers can be added without colours bleeding into the gutter
+func highlightLines(content string, lexer chroma.Lexer) []string {
+	plain := strings.Split(content, "\n")
+	if lexer == nil {
+		return plain
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, content)
+	if err != nil {
+		return plain
+	}
+
+	style := styles.Get("nord")
+	formatter := formatters.Get("terminal256")
+	lines := make([]string, 0, len(plain))
+	for _, tokens := range chroma.SplitTokensIntoLines(iterator.Tokens()) {
+		var buf bytes.Buffer
+		if err := formatter.Format(&buf, style, chroma.Literator(tokens...)); err != nil {
+			return plain
+		}
+		lines = append(lines, strings.TrimRight(buf.String(), "\n"))
+	}
+	// The lexer may add or drop a trailing empty line; keep line numbers aligned with the source
+	for len(lines) < len(plain) {
+		lines = append(lines, "")
+	}
+	return lines[:len(plain)]
+}
+
+// resizeCmd re-lays out the panes after the sidebar is opened or closed
+func (m *Model) resizeCmd() tea.Cmd {
+	width, height := m.Width, m.Height
+	return func() tea.Msg {
+		return tea.WindowSizeMsg{Width: width, Height: height}
+	}
+}
+
+// activePane returns the file or diff in the active tab, or nil
+func (m *Model) activePane() *FilePane {
+	tab := m.activeTab()
+	if tab == nil || (tab.Kind != agent.WindowFile && tab.Kind != agent.WindowDiff) {
+		return nil
+	}
+	return &tab.Pane
+}
+
+// gotoLine highlights a 1-based line of the active file and scrolls it into view
+func (m *Model) gotoLine(line int) {
+	pane := m.activePane()
+	if pane == nil || len(pane.Lines) == 0 {
+		return
+	}
+	pane.Line = min(max(line, 1), len(pane.Lines))
+	m.renderSidebar()
+	// Line N is at row N below the title; leave some context above it
+	m.SideViewport.SetYOffset(pane.Line - m.SideViewport.Height/3)
+}
+
+// findInPane jumps to the next line of the active file containing query (case-insensitive).
+// Repeating the same query moves to the following match.
+func (m *Model) findInPane(query string) {
+	pane := m.activePane()
+	if pane == nil {
+		return
+	}
+	if query != pane.Query || len(pane.Matches) == 0 {
+		pane.Query = query
+		pane.Matches = nil
+		pane.Match = -1
+		needle := strings.ToLower(query)
+		for i, line := range pane.Plain {
+			if strings.Contains(strings.ToLower(line), needle) {
+				pane.Matches = append(pane.Matches, i)
+			}
+		}
+	}
+	if len(pane.Matches) == 0 {
+		m.Status = fmt.Sprintf("No matches for %q", query)
+		m.renderSidebar()
+		return
+	}
+
+	pane.Match = (pane.Match + 1) % len(pane.Matches)
+	m.Status = fmt.Sprintf("Match %d/%d for %q", pane.Match+1, len(pane.Matches), query)
+	m.gotoLine(pane.Matches[pane.Match] + 1)
+}
+
+// renderPane renders a file or diff with a line-number gutter
+func renderPane(pane *FilePane) string {
+	var b strings.Builder
+	title := pane.Path
+	if pane.Kind == agent.WindowDiff {
+		title = "git diff " + pane.Path
+	}
+	b.WriteString(traceStyle.Render(strings.TrimSpace(title)) + "\n")
+
+	matched := make(map[int]bool, len(pane.Matches))
+	for _, i := range pane.Matches {
+		matched[i] = true
+	}
+
+	width := len(fmt.Sprint(len(pane.Lines)))
+	for i, line := range pane.Lines {
+		number := fmt.Sprintf("%*d ", width, i+1)
+		switch {
+		case i+1 == pane.Line:
+			number = paneCurrentLine.Render(number)
+		case matched[i]:
+			number = fileMatched.Render(number)
+		default:
+			number = paneGutter.Render(number)
+		}
+		b.WriteString(number + line + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bethel-nz/trace/pkg/agent"
+	"github.com/bethel-nz/trace/pkg/config"
+)
+
+func TestFilePane(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	source := "package main\n\n/* a\n   multi-line comment */\nfunc main() {\n\tprintln(\"hi\")\n}\n"
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pane, err := loadFilePane(path)
+	if err != nil {
+		t.Fatalf("loadFilePane failed: %v", err)
+	}
+	// Highlighted lines stay aligned with the source, even across multi-line tokens
+	if len(pane.Lines) != 7 || len(pane.Plain) != 7 {
+		t.Fatalf("Expected 7 lines, got %d highlighted and %d plain", len(pane.Lines), len(pane.Plain))
+	}
+	if !strings.Contains(pane.Lines[4], "main") || !strings.Contains(pane.Lines[4], "\x1b[") {
+		t.Errorf("Expected highlighted line 5, got %q", pane.Lines[4])
+	}
+
+	if _, err := loadFilePane(filepath.Join(t.TempDir(), ".env")); err == nil {
+		t.Error("Expected .env to be refused")
+	}
+
+	m := InitialModel(nil, config.Default(), nil, "")
+	m.SideViewport.Height = 3
+	result := m.controlWindow(agent.ManageWindowInput{Action: "open", Target: agent.WindowFile, Path: path, Line: 5})
+	filePane := m.activePane()
+	if result.IsError || !m.ShowSidebar || filePane == nil || filePane.Line != 5 {
+		t.Fatalf("Expected file open at line 5, got %+v", result)
+	}
+
+	// Search wraps around its matches
+	m.findInPane("MAIN")
+	if filePane.Line != 1 || len(filePane.Matches) != 2 {
+		t.Errorf("Expected first of 2 matches on line 1, got line %d, matches %v", filePane.Line, filePane.Matches)
+	}
+	m.findInPane("MAIN")
+	m.findInPane("MAIN")
+	if filePane.Line != 1 {
+		t.Errorf("Expected search to wrap to line 1, got %d", filePane.Line)
+	}
+
+	m.gotoLine(100)
+	if filePane.Line != 7 {
+		t.Errorf("Expected goto to clamp to the last line, got %d", filePane.Line)
+	}
+}
+
+func TestSidebarTabs(t *testing.T) {
+	m := InitialModel(nil, config.Default(), nil, "")
+	m.controlWindow(agent.ManageWindowInput{Action: "open", Target: agent.WindowTodos})
+	m.controlWindow(agent.ManageWindowInput{Action: "open", Target: agent.WindowTerminal})
+	m.openProcessTab("call_1", "go", []string{"test"})
+	if len(m.Tabs) != 2 || m.activeTab().ID != "proc:call_1" {
+		t.Fatalf("Expected the empty terminal to be replaced by the command, got %+v", m.Tabs)
+	}
+
+	result := m.controlWindow(agent.ManageWindowInput{Action: "focus", Tab: "todos"})
+	if result.IsError || m.activeTab().Kind != agent.WindowTodos {
+		t.Errorf("Expected todos tab focused, got %+v", result)
+	}
+	if result := m.controlWindow(agent.ManageWindowInput{Action: "focus", Tab: "nope"}); !result.IsError {
+		t.Error("Expected focusing an unknown tab to fail")
+	}
+
+	// Focus cycles input -> chat -> sidebar -> input
+	m.cycleFocus()
+	m.cycleFocus()
+	if m.Focus != FocusSidebar {
+		t.Errorf("Expected sidebar focus, got %d", m.Focus)
+	}
+
+	m.controlWindow(agent.ManageWindowInput{Action: "close", Target: agent.WindowTodos})
+	m.controlWindow(agent.ManageWindowInput{Action: "close", Target: agent.WindowTerminal})
+	if len(m.Tabs) != 0 || m.ShowSidebar || m.Focus != FocusInput {
+		t.Errorf("Expected closing the last tab to hide the sidebar and return focus, got %d tabs", len(m.Tabs))
+	}
+
+	// The sidebar is skipped while closed
+	m.cycleFocus()
+	m.cycleFocus()
+	if m.Focus != FocusInput {
+		t.Errorf("Expected focus back on input, got %d", m.Focus)
+	}
+}
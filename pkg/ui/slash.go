@@ -0,0 +1,146 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bethel-nz/trace/pkg/agent"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --- Slash Commands ---
+
+// handleSlashCommand runs a local "/command" typed into the input.
+// It returns false if the input is not a known command so it can be sent to the model as-is.
+func (m *Model) handleSlashCommand(input string) (tea.Cmd, bool) {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return nil, false
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(input, fields[0]))
+
+	switch fields[0] {
+	case "/memory":
+		return m.memoryCommand(rest), true
+	case "/plan":
+		m.togglePlanMode()
+		return nil, true
+	case "/approve":
+		return m.approvePlan(), true
+	case "/open":
+		return m.openCommand(rest), true
+	case "/diff":
+		return m.diffCommand(rest), true
+	case "/find":
+		m.findCommand(rest)
+		return nil, true
+	case "/goto":
+		m.gotoCommand(rest)
+		return nil, true
+	case "/queue":
+		m.queueCommand(rest)
+		return nil, true
+	case "/steer":
+		return m.steerCommand(rest), true
+	case "/branch":
+		return m.branchCommand(rest), true
+	case "/rewind":
+		return m.rewindCommand(rest), true
+	}
+	return nil, false
+}
+
+// /open <path>[:line] -> show a file in the sidebar
+func (m *Model) openCommand(arg string) tea.Cmd {
+	if arg == "" {
+		m.Status = "Usage: /open <path>[:line]"
+		return nil
+	}
+	path, line := arg, 0
+	if i := strings.LastIndex(arg, ":"); i > 0 {
+		if n, err := strconv.Atoi(arg[i+1:]); err == nil {
+			path, line = arg[:i], n
+		}
+	}
+	if err := m.openFileTab(strings.TrimPrefix(path, "@"), line); err != nil {
+		m.Status = err.Error()
+		return nil
+	}
+	m.Status = ""
+	return m.resizeCmd()
+}
+
+// /diff [path] -> show uncommitted changes in the sidebar
+func (m *Model) diffCommand(path string) tea.Cmd {
+	if err := m.openDiffTab(strings.TrimPrefix(path, "@")); err != nil {
+		m.Status = err.Error()
+		return nil
+	}
+	m.Status = ""
+	return m.resizeCmd()
+}
+
+// /find <text> -> jump to the next match in the sidebar file; /find alone repeats the last search
+func (m *Model) findCommand(query string) {
+	pane := m.activePane()
+	if pane == nil || !m.ShowSidebar {
+		m.Status = "Open a file with /open or /diff first"
+		return
+	}
+	if query == "" {
+		query = pane.Query
+	}
+	if query == "" {
+		m.Status = "Usage: /find <text>"
+		return
+	}
+	m.findInPane(query)
+}
+
+// /goto <line> -> scroll the sidebar file to a line
+func (m *Model) gotoCommand(arg string) {
+	pane := m.activePane()
+	if pane == nil || !m.ShowSidebar {
+		m.Status = "Open a file with /open or /diff first"
+		return
+	}
+	line, err := strconv.Atoi(arg)
+	if err != nil {
+		m.Status = "Usage: /goto <line>"
+		return
+	}
+	m.gotoLine(line)
+	m.Status = fmt.Sprintf("Line %d of %d", pane.Line, len(pane.Lines))
+}
+
+// /memory        -> show the merged memory files in the sidebar
+// /memory <note> -> append a note to the project TRACE.md
+func (m *Model) memoryCommand(note string) tea.Cmd {
+	if note == "" {
+		files := agent.FindMemoryFiles(".")
+		var b strings.Builder
+		if len(files) == 0 {
+			fmt.Fprintf(&b, "No memory files found.\n\nUse /memory <note> to create %s.", agent.ProjectMemoryPath())
+		}
+		for _, f := range files {
+			fmt.Fprintf(&b, "── %s (%s) ──\n\n%s\n\n", f.Path, f.Scope, strings.TrimSpace(f.Content))
+		}
+		m.openTab(SidebarTab{ID: "memory", Title: "memory", Kind: tabText, Output: b.String()})
+		return m.resizeCmd()
+	}
+
+	path := agent.ProjectMemoryPath()
+	if err := agent.AppendMemory(path, note); err != nil {
+		m.Status = fmt.Sprintf("Failed to save memory: %v", err)
+		return nil
+	}
+
+	// Refresh the system prompt so the note applies to the rest of this session too
+	if len(m.History) > 0 && m.History[0].Role == "system" {
+		m.History[0].Content = agent.WithMemory(m.BasePrompt)
+	}
+	m.Status = "Saved to " + path
+	return nil
+}
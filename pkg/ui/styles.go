@@ -23,10 +23,34 @@ var (
 	// Layout styles
 	fileSelected = lipgloss.NewStyle().Foreground(nordFrost2).Bold(true)
 	fileNormal   = lipgloss.NewStyle().Foreground(nordSnowStorm)
+	fileMatched  = lipgloss.NewStyle().Foreground(nordAuroraYellow).Bold(true)
 
 	// Chat styles
 	// Chat styles
 	userStyle  = lipgloss.NewStyle().Foreground(nordAuroraGreen).Bold(true).MarginLeft(2)
 	traceStyle = lipgloss.NewStyle().Foreground(nordFrost2).Bold(true).MarginLeft(2)
 	mutedStyle = lipgloss.NewStyle().Foreground(nordPolarNight4).Italic(true).MarginLeft(2)
+
+	// Checklist styles (plan steps, todos)
+	checkDone    = lipgloss.NewStyle().Foreground(nordAuroraGreen).MarginLeft(2)
+	checkActive  = lipgloss.NewStyle().Foreground(nordAuroraYellow).Bold(true).MarginLeft(2)
+	checkPending = lipgloss.NewStyle().Foreground(nordSnowStorm).MarginLeft(2)
+
+	// Sidebar tab bar styles
+	tabActive   = lipgloss.NewStyle().Foreground(nordPolarNight1).Background(nordFrost2).Bold(true).Padding(0, 1)
+	tabInactive = lipgloss.NewStyle().Foreground(nordPolarNight4).Padding(0, 1)
+
+	// Sidebar file view styles
+	paneGutter      = lipgloss.NewStyle().Foreground(nordPolarNight4)
+	paneCurrentLine = lipgloss.NewStyle().Foreground(nordPolarNight1).Background(nordAuroraYellow).Bold(true)
+
+	// Tool card styles
+	toolCard         = lipgloss.NewStyle().MarginLeft(2)
+	toolCardSelected = lipgloss.NewStyle().MarginLeft(1).Border(lipgloss.NormalBorder(), false, false, false, true).BorderForeground(nordFrost2)
+	toolBody         = lipgloss.NewStyle().MarginLeft(4).Border(lipgloss.NormalBorder(), false, false, false, true).BorderForeground(nordPolarNight4).PaddingLeft(1)
+	toolName         = lipgloss.NewStyle().Foreground(nordFrost2).Bold(true)
+	toolMeta         = lipgloss.NewStyle().Foreground(nordPolarNight4)
+	toolOK           = lipgloss.NewStyle().Foreground(nordAuroraGreen)
+	toolRunning      = lipgloss.NewStyle().Foreground(nordAuroraYellow)
+	toolFailed       = lipgloss.NewStyle().Foreground(nordAuroraRed).Bold(true)
 )
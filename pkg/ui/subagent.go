@@ -0,0 +1,125 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/bethel-nz/trace/pkg/agent"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Sub-agent Delegation ---
+
+const subagentSystemPrompt = `You are a sub-agent of Trace, an AI coding assistant. You have been delegated a single task by the main agent.
+
+- Work autonomously using your tools; nobody will answer questions.
+- Stay focused on the task. Do not do unrelated work.
+- When you are done, reply WITHOUT calling tools. That reply is the only thing the main agent will see, so make it a concise, complete summary of your findings or changes, including relevant file paths.`
+
+// DelegateTaskMsg asks the UI to run a sub-agent for a delegate_task tool call
+type DelegateTaskMsg struct {
+	Input      agent.DelegateTaskInput
+	ToolCallID string
+	History    []openai.ChatCompletionMessage
+}
+
+// SubagentDoneMsg carries the sub-agent's summary back to the parent session
+type SubagentDoneMsg struct {
+	ToolCallID string
+	Summary    string
+	Transcript []openai.ChatCompletionMessage
+	Err        error
+}
+
+// RunSubagentCmd runs a child agent session to completion with its own history,
+// restricted tool set and iteration budget
+func RunSubagentCmd(complete completionFunc, input agent.DelegateTaskInput, toolCallID string) tea.Cmd {
+	return func() tea.Msg {
+		summary, transcript, err := runSubagent(complete, input)
+		return SubagentDoneMsg{ToolCallID: toolCallID, Summary: summary, Transcript: transcript, Err: err}
+	}
+}
+
+func runSubagent(complete completionFunc, input agent.DelegateTaskInput) (string, []openai.ChatCompletionMessage, error) {
+	model := modelName()
+	if model == "" {
+		return "", nil, errors.New("ANTHROPIC_MODEL not set in .env")
+	}
+
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: subagentSystemPrompt},
+		{Role: openai.ChatMessageRoleUser, Content: input.Task},
+	}
+	tools := convertToolsToOpenAI(agent.SubagentTools(input.Mode))
+
+	for iteration := 0; iteration < input.MaxIterations; iteration++ {
+		slog.Info("Calling AI (sub-agent)", "model", model, "messageCount", len(messages), "iteration", iteration)
+
+		resp, err := complete(openai.ChatCompletionRequest{
+			Model:    model,
+			Messages: messages,
+			Tools:    tools,
+		})
+		if err != nil {
+			return "", messages, fmt.Errorf("API error: %v", err)
+		}
+		if len(resp.Choices) == 0 {
+			return "", messages, errors.New("no response from model")
+		}
+
+		choice := resp.Choices[0]
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:      openai.ChatMessageRoleAssistant,
+			Content:   choice.Message.Content,
+			ToolCalls: choice.Message.ToolCalls,
+		})
+
+		if len(choice.Message.ToolCalls) == 0 {
+			return choice.Message.Content, messages, nil
+		}
+
+		for _, toolCall := range choice.Message.ToolCalls {
+			slog.Info("Executing tool (sub-agent)", "name", toolCall.Function.Name, "id", toolCall.ID)
+			result := executeSubagentTool(input.Mode, toolCall)
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    result.ForModel(),
+				ToolCallID: toolCall.ID,
+			})
+		}
+	}
+
+	// Out of budget: ask for a summary of what was found so far, without tools
+	slog.Warn("Sub-agent iteration budget exhausted", "budget", input.MaxIterations)
+	messages = append(messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: "You have run out of steps. Summarize what you found or changed so far and what remains to be done.",
+	})
+	resp, err := complete(openai.ChatCompletionRequest{
+		Model:    model,
+		Messages: messages,
+	})
+	if err != nil {
+		return "", messages, fmt.Errorf("API error: %v", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", messages, errors.New("no response from model")
+	}
+	summary := resp.Choices[0].Message.Content
+	messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: summary})
+	return "(Sub-agent ran out of iterations)\n\n" + summary, messages, nil
+}
+
+// executeSubagentTool runs a tool only if it belongs to the sub-agent's tool set
+func executeSubagentTool(mode string, toolCall openai.ToolCall) agent.ToolResult {
+	for _, def := range agent.SubagentTools(mode) {
+		if def.Name == toolCall.Function.Name {
+			return agent.ExecuteToolByName(def.Name, json.RawMessage(toolCall.Function.Arguments))
+		}
+	}
+	return agent.ErrorResult(fmt.Errorf("tool %s is not available to this sub-agent (mode: %s)", toolCall.Function.Name, mode))
+}
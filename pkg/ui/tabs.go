@@ -0,0 +1,352 @@
+package ui
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bethel-nz/trace/pkg/agent"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --- Sidebar Tabs & Focus ---
+
+// FocusArea is the pane that receives scroll keys
+type FocusArea int
+
+const (
+	FocusInput FocusArea = iota
+	FocusChat
+	FocusSidebar
+)
+
+// Finished command tabs kept before the oldest is dropped
+const maxTerminalTabs = 5
+
+// tabText is a plain text tab, e.g. the merged memory files
+const tabText = "text"
+
+// SidebarTab is one named view in the sidebar
+type SidebarTab struct {
+	ID      string   // Unique key, e.g. "file:main.go" or "proc:<tool call ID>"
+	Title   string   // Shown in the tab bar
+	Kind    string   // agent.WindowTerminal, WindowFile, WindowDiff, WindowTodos, WindowGit or tabText
+	Pane    FilePane // Content of file and diff tabs
+	Output  string   // Content of terminal, git and text tabs
+	Running bool     // Terminal tab whose process is still running
+}
+
+// activeTab returns the tab shown in the sidebar, or nil when there are none
+func (m *Model) activeTab() *SidebarTab {
+	if m.ActiveTab < 0 || m.ActiveTab >= len(m.Tabs) {
+		return nil
+	}
+	return &m.Tabs[m.ActiveTab]
+}
+
+// tabIndex returns the index of the tab with the given ID, or -1
+func (m *Model) tabIndex(id string) int {
+	for i, tab := range m.Tabs {
+		if tab.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// openTab adds a tab, or replaces the tab with the same ID in place, and shows it
+func (m *Model) openTab(tab SidebarTab) *SidebarTab {
+	i := m.tabIndex(tab.ID)
+	if i == -1 {
+		if tab.Kind == agent.WindowTerminal {
+			m.pruneTerminalTabs()
+		}
+		m.Tabs = append(m.Tabs, tab)
+		i = len(m.Tabs) - 1
+	} else {
+		m.Tabs[i] = tab
+	}
+	m.ActiveTab = i
+	m.ShowSidebar = true
+	m.renderSidebar()
+	m.SideViewport.GotoTop()
+	return &m.Tabs[i]
+}
+
+// pruneTerminalTabs drops the oldest finished command tabs to make room for a new one
+func (m *Model) pruneTerminalTabs() {
+	count := 0
+	for _, tab := range m.Tabs {
+		if tab.Kind == agent.WindowTerminal {
+			count++
+		}
+	}
+	for i := 0; i < len(m.Tabs) && count >= maxTerminalTabs; {
+		if m.Tabs[i].Kind == agent.WindowTerminal && !m.Tabs[i].Running {
+			m.closeTab(i)
+			count--
+			continue
+		}
+		i++
+	}
+}
+
+// closeTab removes a tab; closing the last tab hides the sidebar
+func (m *Model) closeTab(i int) {
+	m.Tabs = append(m.Tabs[:i], m.Tabs[i+1:]...)
+	if m.ActiveTab >= i && m.ActiveTab > 0 {
+		m.ActiveTab--
+	}
+	if len(m.Tabs) == 0 {
+		m.ShowSidebar = false
+		if m.Focus == FocusSidebar {
+			m.setFocus(FocusInput)
+		}
+	}
+	m.renderSidebar()
+}
+
+// cycleTab switches to the next (or previous) tab
+func (m *Model) cycleTab(delta int) {
+	if len(m.Tabs) == 0 {
+		return
+	}
+	m.ActiveTab = (m.ActiveTab + delta + len(m.Tabs)) % len(m.Tabs)
+	m.refreshTab(m.activeTab())
+	m.renderSidebar()
+}
+
+// refreshTab reloads tabs that mirror live state (git status)
+func (m *Model) refreshTab(tab *SidebarTab) {
+	if tab != nil && tab.Kind == agent.WindowGit {
+		tab.Output = gitStatus()
+	}
+}
+
+// cycleFocus moves keyboard focus input -> chat -> sidebar (when open) -> input
+func (m *Model) cycleFocus() {
+	switch m.Focus {
+	case FocusInput:
+		m.setFocus(FocusChat)
+	case FocusChat:
+		if m.ShowSidebar && len(m.Tabs) > 0 {
+			m.setFocus(FocusSidebar)
+		} else {
+			m.setFocus(FocusInput)
+		}
+	default:
+		m.setFocus(FocusInput)
+	}
+}
+
+func (m *Model) setFocus(focus FocusArea) {
+	m.Focus = focus
+	if focus == FocusInput {
+		m.Input.Focus()
+	} else {
+		m.Input.Blur()
+	}
+}
+
+// updateFocusedPane handles keys while the chat or sidebar has focus
+func (m *Model) updateFocusedPane(msg tea.KeyMsg) tea.Cmd {
+	var cmd tea.Cmd
+	if m.Focus == FocusChat {
+		if msg.String() == "enter" || msg.String() == " " {
+			m.toggleCard()
+			return nil
+		}
+		m.Viewport, cmd = m.Viewport.Update(msg)
+		return cmd
+	}
+
+	switch msg.String() {
+	case "left", "h":
+		m.cycleTab(-1)
+		return nil
+	case "right", "l":
+		m.cycleTab(1)
+		return nil
+	case "x":
+		if len(m.Tabs) > 0 {
+			m.closeTab(m.ActiveTab)
+			return m.resizeCmd()
+		}
+		return nil
+	case "n":
+		if pane := m.activePane(); pane != nil && pane.Query != "" {
+			m.findInPane(pane.Query)
+		}
+		return nil
+	}
+	m.SideViewport, cmd = m.SideViewport.Update(msg)
+	return cmd
+}
+
+// findTab locates the tab a manage_window call refers to, by name or by target and path
+func (m *Model) findTab(input agent.ManageWindowInput) int {
+	if input.Tab != "" {
+		for i, tab := range m.Tabs {
+			if strings.EqualFold(tab.Title, input.Tab) || tab.ID == input.Tab {
+				return i
+			}
+		}
+		return -1
+	}
+	switch input.Target {
+	case agent.WindowFile:
+		return m.tabIndex("file:" + input.Path)
+	case agent.WindowTerminal, "":
+		// The most recent command
+		for i := len(m.Tabs) - 1; i >= 0; i-- {
+			if m.Tabs[i].Kind == agent.WindowTerminal {
+				return i
+			}
+		}
+		return -1
+	}
+	return m.tabIndex(input.Target)
+}
+
+// controlWindow applies a manage_window call to the sidebar
+func (m *Model) controlWindow(input agent.ManageWindowInput) agent.ToolResult {
+	switch input.Action {
+	case "close":
+		if input.Target == "" && input.Tab == "" {
+			m.ShowSidebar = false
+			if m.Focus == FocusSidebar {
+				m.setFocus(FocusInput)
+			}
+			return agent.ToolResult{Content: "Sidebar closed."}
+		}
+		i := m.findTab(input)
+		if i == -1 {
+			return agent.ErrorResult(fmt.Errorf("no such tab; open tabs: %s", m.tabTitles()))
+		}
+		title := m.Tabs[i].Title
+		m.closeTab(i)
+		return agent.ToolResult{Content: fmt.Sprintf("Closed tab %q.", title)}
+
+	case "focus":
+		i := m.findTab(input)
+		if i == -1 {
+			return agent.ErrorResult(fmt.Errorf("no such tab; open tabs: %s", m.tabTitles()))
+		}
+		m.ActiveTab = i
+		m.ShowSidebar = true
+		m.refreshTab(m.activeTab())
+		m.renderSidebar()
+		if input.Line > 0 {
+			m.gotoLine(input.Line)
+		}
+		return agent.ToolResult{Content: fmt.Sprintf("Showing tab %q.", m.Tabs[i].Title)}
+	}
+
+	switch input.Target {
+	case agent.WindowFile:
+		if err := m.openFileTab(input.Path, input.Line); err != nil {
+			return agent.ErrorResult(err)
+		}
+		return agent.ToolResult{Content: fmt.Sprintf("Showing %s (%d lines) in the sidebar.", input.Path, len(m.activeTab().Pane.Lines))}
+	case agent.WindowDiff:
+		if err := m.openDiffTab(input.Path); err != nil {
+			return agent.ErrorResult(err)
+		}
+		return agent.ToolResult{Content: "Showing the uncommitted diff in the sidebar."}
+	case agent.WindowTodos:
+		m.openTodosTab()
+		return agent.ToolResult{Content: "Showing the todo list in the sidebar."}
+	case agent.WindowGit:
+		m.openTab(SidebarTab{ID: agent.WindowGit, Title: "git", Kind: agent.WindowGit, Output: gitStatus()})
+		return agent.ToolResult{Content: "Showing git status in the sidebar."}
+	}
+
+	// Terminal: show the latest command, or an empty terminal ready for the next one
+	if i := m.findTab(input); i != -1 {
+		m.ActiveTab = i
+		m.ShowSidebar = true
+		m.renderSidebar()
+	} else {
+		m.openTab(SidebarTab{ID: agent.WindowTerminal, Title: "terminal", Kind: agent.WindowTerminal})
+	}
+	return agent.ToolResult{Content: "Sidebar opened on the terminal."}
+}
+
+// openFileTab shows a syntax-highlighted file, optionally at a line
+func (m *Model) openFileTab(path string, line int) error {
+	pane, err := loadFilePane(path)
+	if err != nil {
+		return err
+	}
+	m.openTab(SidebarTab{ID: "file:" + path, Title: filepath.Base(path), Kind: agent.WindowFile, Pane: pane})
+	if line > 0 {
+		m.gotoLine(line)
+	}
+	return nil
+}
+
+// openDiffTab shows uncommitted changes, optionally limited to one path
+func (m *Model) openDiffTab(path string) error {
+	pane, err := loadDiffPane(path)
+	if err != nil {
+		return err
+	}
+	m.openTab(SidebarTab{ID: agent.WindowDiff, Title: "diff", Kind: agent.WindowDiff, Pane: pane})
+	return nil
+}
+
+// openTodosTab shows the todo list
+func (m *Model) openTodosTab() {
+	m.openTab(SidebarTab{ID: agent.WindowTodos, Title: "todos", Kind: agent.WindowTodos})
+}
+
+// openProcessTab starts a terminal tab for a run_command process
+func (m *Model) openProcessTab(toolCallID, command string, args []string) {
+	// An empty terminal opened ahead of time by manage_window is replaced by the real one
+	if i := m.tabIndex(agent.WindowTerminal); i != -1 && m.Tabs[i].Output == "" {
+		m.closeTab(i)
+	}
+	title := "$ " + truncate(strings.Join(append([]string{command}, args...), " "), 20)
+	m.ProcessTab = "proc:" + toolCallID
+	m.openTab(SidebarTab{ID: m.ProcessTab, Title: title, Kind: agent.WindowTerminal, Running: true})
+}
+
+func (m *Model) tabTitles() string {
+	if len(m.Tabs) == 0 {
+		return "(none)"
+	}
+	titles := make([]string, len(m.Tabs))
+	for i, tab := range m.Tabs {
+		titles[i] = fmt.Sprintf("%q", tab.Title)
+	}
+	return strings.Join(titles, ", ")
+}
+
+// renderTabBar renders the tab titles above the sidebar content
+func (m Model) renderTabBar() string {
+	var titles []string
+	for i, tab := range m.Tabs {
+		title := tab.Title
+		if tab.Running {
+			title += " ●"
+		}
+		if i == m.ActiveTab {
+			titles = append(titles, tabActive.Render(title))
+		} else {
+			titles = append(titles, tabInactive.Render(title))
+		}
+	}
+	return lipgloss.NewStyle().MaxWidth(m.SideViewport.Width).Render(strings.Join(titles, tabInactive.Render("│")))
+}
+
+// gitStatus returns a short git status for the git tab
+func gitStatus() string {
+	out, err := exec.Command("git", "status", "--short", "--branch").CombinedOutput()
+	if err != nil {
+		return "git status failed: " + strings.TrimSpace(string(out))
+	}
+	return string(out)
+}
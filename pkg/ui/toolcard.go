@@ -0,0 +1,272 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// --- Tool Cards ---
+
+// Lines of tool output shown in an expanded card
+const cardPreviewLines = 12
+
+// Arguments worth showing in a collapsed card, in order of preference
+var cardSummaryKeys = []string{"path", "task", "note", "action", "query", "url", "name"}
+
+// toggleCard expands or collapses the selected card, or every card when none is selected.
+// A selected user message is opened for editing instead.
+func (m *Model) toggleCard() {
+	if index, ok := strings.CutPrefix(m.SelectedCard, messageSelectPrefix); ok {
+		i, _ := strconv.Atoi(index)
+		m.editMessage(i)
+		return
+	}
+	if m.SelectedCard == "" {
+		m.ExpandAll = !m.ExpandAll
+		m.ExpandedCards = make(map[string]bool)
+	} else {
+		m.ExpandedCards[m.SelectedCard] = !m.cardExpanded(m.SelectedCard)
+	}
+	m.RenderChat()
+	m.scrollToCard()
+}
+
+// selectCard moves the selection between cards and user messages and scrolls the chat to it.
+// Starting with no selection, next picks the first card and previous the last.
+func (m *Model) selectCard(next bool) {
+	if len(m.cardIDs) == 0 {
+		return
+	}
+	idx := -1
+	for i, id := range m.cardIDs {
+		if id == m.SelectedCard {
+			idx = i
+		}
+	}
+	switch {
+	case idx == -1 && next:
+		idx = 0
+	case idx == -1:
+		idx = len(m.cardIDs) - 1
+	case next && idx < len(m.cardIDs)-1:
+		idx++
+	case !next && idx > 0:
+		idx--
+	}
+	m.SelectedCard = m.cardIDs[idx]
+	m.RenderChat()
+	m.scrollToCard()
+}
+
+// scrollToCard brings the selected card into view
+func (m *Model) scrollToCard() {
+	for i, id := range m.cardIDs {
+		if id != m.SelectedCard {
+			continue
+		}
+		line := m.cardLines[i]
+		if line < m.Viewport.YOffset || line >= m.Viewport.YOffset+m.Viewport.Height {
+			m.Viewport.SetYOffset(line)
+		}
+		return
+	}
+}
+
+func (m *Model) cardExpanded(id string) bool {
+	if expanded, ok := m.ExpandedCards[id]; ok {
+		return expanded
+	}
+	return m.ExpandAll
+}
+
+// renderToolCard renders one tool call: a header line with status, arguments and duration,
+// and when expanded the full arguments and a preview of the result.
+// result is the tool message answering the call, nil while it is still running.
+func (m *Model) renderToolCard(tc openai.ToolCall, result *openai.ChatCompletionMessage) string {
+	var b strings.Builder
+	width := max(m.Viewport.Width-6, 20)
+	entry, _ := m.ToolLog.Get(tc.ID)
+	expanded := m.cardExpanded(tc.ID)
+
+	// Header: ▸ ✓ read_file pkg/ui/view.go · 0.2s
+	arrow := "▸"
+	if expanded {
+		arrow = "▾"
+	}
+	var status string
+	switch {
+	case result == nil:
+		status = toolRunning.Render("●")
+	case entry.Result.IsError:
+		status = toolFailed.Render("✗")
+	default:
+		status = toolOK.Render("✓")
+	}
+
+	header := fmt.Sprintf("%s %s %s", arrow, status, toolName.Render(tc.Function.Name))
+	if summary := summarizeArgs(tc.Function.Arguments); summary != "" {
+		header += " " + toolMeta.Render(truncate(summary, max(width-len(tc.Function.Name)-16, 10)))
+	}
+	switch {
+	case result == nil:
+		header += toolMeta.Render(" · running…")
+	case entry.Result.IsError && entry.Result.ExitCode != 0:
+		header += toolFailed.Render(fmt.Sprintf(" · exit %d", entry.Result.ExitCode))
+	case entry.Result.IsError:
+		header += toolFailed.Render(" · error")
+	}
+	if entry.Duration > 0 {
+		header += toolMeta.Render(" · " + formatDuration(entry.Duration))
+	}
+
+	style := toolCard
+	if tc.ID == m.SelectedCard {
+		style = toolCardSelected
+	}
+	b.WriteString(style.Render(header))
+
+	if !expanded {
+		// Failures are worth a glance even when collapsed
+		if entry.Result.IsError {
+			b.WriteString("\n" + toolBody.Render(toolFailed.Render(truncate(entry.Result.Summary(), width))))
+		}
+		return b.String()
+	}
+
+	var body []string
+	for _, line := range formatArgs(tc.Function.Arguments) {
+		body = append(body, toolMeta.Render(truncate(line, width)))
+	}
+
+	if tc.Function.Name == "delegate_task" {
+		body = append(body, m.subagentActivity(tc.ID, width)...)
+	} else if result != nil {
+		if len(body) > 0 {
+			body = append(body, "")
+		}
+		body = append(body, resultPreview(result.Content, width)...)
+	}
+
+	for _, line := range body {
+		b.WriteString("\n" + toolBody.Render(line))
+	}
+	return b.String()
+}
+
+// subagentActivity lists what a sub-agent did, for its expanded card
+func (m *Model) subagentActivity(toolCallID string, width int) []string {
+	transcript, done := m.Subagents[toolCallID]
+	if !done {
+		return nil
+	}
+	var lines []string
+	for _, msg := range transcript {
+		switch msg.Role {
+		case openai.ChatMessageRoleAssistant:
+			if msg.Content != "" {
+				lines = append(lines, truncate(msg.Content, width))
+			}
+			for _, call := range msg.ToolCalls {
+				lines = append(lines, truncate(fmt.Sprintf("→ %s %s", call.Function.Name, summarizeArgs(call.Function.Arguments)), width))
+			}
+		case openai.ChatMessageRoleTool:
+			lines = append(lines, "  "+truncate(msg.Content, width-2))
+		}
+	}
+	return lines
+}
+
+// summarizeArgs picks the most telling argument of a call, e.g. the path or the command line
+func summarizeArgs(arguments string) string {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return arguments
+	}
+
+	if command, ok := args["command"].(string); ok {
+		parts := []string{command}
+		if list, ok := args["args"].([]any); ok {
+			for _, a := range list {
+				parts = append(parts, fmt.Sprint(a))
+			}
+		}
+		return strings.Join(parts, " ")
+	}
+	for _, key := range cardSummaryKeys {
+		if value, ok := args[key]; ok {
+			return fmt.Sprint(value)
+		}
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	return arguments
+}
+
+// formatArgs lists the call's arguments one per line, sorted by name
+func formatArgs(arguments string) []string {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return []string{arguments}
+	}
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := args[key]
+		if _, ok := value.(string); !ok {
+			raw, _ := json.Marshal(value)
+			value = string(raw)
+		}
+		lines = append(lines, fmt.Sprintf("%s: %v", key, value))
+	}
+	return lines
+}
+
+// resultPreview returns the first lines of a tool result
+func resultPreview(content string, width int) []string {
+	content = strings.TrimRight(content, "\n")
+	if content == "" {
+		return []string{"(no output)"}
+	}
+	all := strings.Split(content, "\n")
+	lines := all
+	if len(lines) > cardPreviewLines {
+		lines = lines[:cardPreviewLines]
+	}
+	preview := make([]string, 0, len(lines)+1)
+	for _, line := range lines {
+		preview = append(preview, truncateLine(line, width))
+	}
+	if len(all) > len(lines) {
+		preview = append(preview, toolMeta.Render(fmt.Sprintf("… %d more lines", len(all)-len(lines))))
+	}
+	return preview
+}
+
+// truncateLine shortens a line without collapsing its whitespace, so code stays aligned
+func truncateLine(s string, n int) string {
+	s = strings.ReplaceAll(s, "\t", "    ")
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return s
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
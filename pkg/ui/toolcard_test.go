@@ -0,0 +1,78 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bethel-nz/trace/pkg/agent"
+	"github.com/bethel-nz/trace/pkg/config"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestSummarizeArgs(t *testing.T) {
+	tests := map[string]string{
+		`{"command":"go","args":["test","./..."]}`: "go test ./...",
+		`{"path":"main.go","search_text":"x"}`:     "main.go",
+		`{}`:                                       "",
+		`not json`:                                 "not json",
+	}
+	for args, want := range tests {
+		if got := summarizeArgs(args); got != want {
+			t.Errorf("summarizeArgs(%s) = %q, want %q", args, got, want)
+		}
+	}
+}
+
+func TestToolCards(t *testing.T) {
+	m := InitialModel(nil, config.Default(), nil, "")
+	m.Viewport.Width, m.Viewport.Height = 80, 100
+	m.History = []openai.ChatCompletionMessage{
+		toolCallMsg("1", "read_file", `{"path":"a.go"}`),
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "1", Content: "File: a.go\npackage a"},
+		toolCallMsg("2", "run_command", `{"command":"false"}`),
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "2", Content: "Error"},
+		toolCallMsg("3", "list_files", `{}`),
+	}
+	m.ToolLog.Record("2", agent.ToolResult{Content: "boom", IsError: true, ExitCode: 1})
+	m.RenderChat()
+
+	if len(m.cardIDs) != 3 {
+		t.Fatalf("Expected 3 cards, got %v", m.cardIDs)
+	}
+	content := m.Viewport.View()
+	for _, want := range []string{"✓", "exit 1", "boom", "running…"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Expected %q in chat:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "package a") {
+		t.Error("Collapsed card should not show the result")
+	}
+
+	// Select the first card and expand only it
+	m.selectCard(true)
+	m.toggleCard()
+	if m.SelectedCard != "1" || !m.cardExpanded("1") || m.cardExpanded("2") {
+		t.Errorf("Unexpected card state: selected %q, expanded %v", m.SelectedCard, m.ExpandedCards)
+	}
+	if !strings.Contains(m.Viewport.View(), "package a") {
+		t.Error("Expanded card should preview the result")
+	}
+}
+
+func TestToolCardsNarrowViewport(t *testing.T) {
+	m := InitialModel(nil, config.Default(), nil, "")
+	m.Viewport.Width, m.Viewport.Height = 36, 100
+	m.History = []openai.ChatCompletionMessage{
+		toolCallMsg("1", "delegate_task", `{"task":"Look through the whole repository for uses of the old API"}`),
+		toolCallMsg("2", "mcp_some_server_with_a_very_long_tool_name", `{"path":"a/very/long/path/to/a/file.go"}`),
+	}
+	m.ExpandAll = true
+	m.RenderChat() // Must not panic on a negative truncation budget
+
+	for n, want := range map[int]string{-2: "", 0: "", 2: "ab", 3: "abc", 5: "ab..."} {
+		if got := truncate("abcdefgh", n); got != want {
+			t.Errorf("truncate(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
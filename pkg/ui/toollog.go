@@ -0,0 +1,79 @@
+package ui
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/bethel-nz/trace/pkg/agent"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ToolLog records tool results and timings by tool call ID for the tool cards in the chat.
+// Tools run inside tea.Cmd goroutines, so access is synchronised.
+type ToolLog struct {
+	mu      sync.Mutex
+	entries map[string]ToolEntry
+}
+
+// ToolEntry is what the chat knows about one tool call
+type ToolEntry struct {
+	Result   agent.ToolResult
+	Started  time.Time
+	Duration time.Duration
+	Done     bool
+}
+
+func newToolLog() *ToolLog {
+	return &ToolLog{entries: make(map[string]ToolEntry)}
+}
+
+// Start marks a tool call as running
+func (l *ToolLog) Start(toolCallID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[toolCallID] = ToolEntry{Started: time.Now()}
+}
+
+// Record stores the result of a tool call, timing it from Start if it was called
+func (l *ToolLog) Record(toolCallID string, result agent.ToolResult) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry := l.entries[toolCallID]
+	entry.Result = result
+	entry.Done = true
+	if !entry.Started.IsZero() {
+		entry.Duration = time.Since(entry.Started)
+	}
+	l.entries[toolCallID] = entry
+}
+
+// Get returns what is known about a tool call
+func (l *ToolLog) Get(toolCallID string) (ToolEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.entries[toolCallID]
+	return entry, ok
+}
+
+// appendToolResult records a result produced by the UI and adds it to the history
+func (m *Model) appendToolResult(toolCallID string, result agent.ToolResult) {
+	m.ToolLog.Record(toolCallID, result)
+	m.History = append(m.History, openai.ChatCompletionMessage{
+		Role:       openai.ChatMessageRoleTool,
+		Content:    result.ForModel(),
+		ToolCallID: toolCallID,
+	})
+}
+
+// processResult describes a streamed run_command process that has exited
+func processResult(content string, err error) agent.ToolResult {
+	result := agent.ToolResult{Content: content, IsError: err != nil}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+	}
+	return result
+}
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bethel-nz/trace/pkg/agent"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/sashabaranov/go-openai"
 )
@@ -26,31 +28,22 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	// Window Control: Toggle sidebar and resume AI
 	case WindowControlMsg:
-		switch msg.Action {
-		case "open":
-			m.ShowSidebar = true
-		case "close":
-			m.ShowSidebar = false
-		}
-
-		// 1. Update History with tool result
-		result := fmt.Sprintf("Window action '%s' triggered.", msg.Action)
 		m.History = msg.History
-		m.History = append(m.History, openai.ChatCompletionMessage{
-			Role:       openai.ChatMessageRoleTool,
-			Content:    result,
-			ToolCallID: msg.ToolCallID,
-		})
+		m.appendToolResult(msg.ToolCallID, m.controlWindow(msg.Input))
+		m.RenderChat()
+		m.Viewport.GotoBottom()
 
-		// 2. Resume AI
+		// Re-layout for the new sidebar state, then resume the AI
 		m.State = StateThinking
+		return m, tea.Batch(m.resizeCmd(), m.resumeTurn())
 
-		// 3. Trigger Resize (to update component widths) + Resume AI
-		// We use a batch cmd
-		resizeCmd := func() tea.Msg {
-			return tea.WindowSizeMsg{Width: m.Width, Height: m.Height}
-		}
-		return m, tea.Batch(resizeCmd, m.InvokeAI())
+	// Tool calls the UI runs, one at a time, after the rest of their batch
+	case ToolBatchMsg:
+		m.History = msg.History
+		m.PendingTools = msg.Calls
+		m.RenderChat()
+		m.Viewport.GotoBottom()
+		return m, m.resumeTurn()
 
 	case tea.WindowSizeMsg:
 		m.Width = msg.Width
@@ -78,7 +71,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			// Resize side viewport
 			m.SideViewport.Width = sidebarWidth - 2 // Padding/Border
-			m.SideViewport.Height = chatHeight
+			m.SideViewport.Height = chatHeight - 1  // Tab bar
 		}
 
 		m.Viewport.Width = chatWidth
@@ -90,75 +83,159 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.RenderChat()
 
 	case tea.KeyMsg:
+		// Worktree exit prompt: m/p/d/k finish the session, anything else goes back to it
+		if m.WorktreeChanges != "" {
+			return m, m.finishWorktree(msg.String())
+		}
+
+		// Budget prompt: y continues the turn, n stops it, ctrl+c still quits
+		if m.State == StateConfirmContinue {
+			switch msg.String() {
+			case "y", "Y", "enter":
+				return m, m.continueTurn()
+			case "n", "N", "esc":
+				m.State = StateIdle
+				return m, m.stopTurn()
+			case "ctrl+c":
+				return m, m.quit()
+			}
+			return m, nil
+		}
+
 		switch msg.String() {
 		case "ctrl+c", "esc":
 			if m.ShowAutocomplete {
 				m.ShowAutocomplete = false
 				return m, nil
 			}
-			m.SaveSession()
-			return m, tea.Quit
-
-		case "up":
-			if m.ShowAutocomplete && m.AutocompleteIdx > 0 {
-				m.AutocompleteIdx--
+			if msg.String() == "esc" && m.EditingMessage > 0 {
+				m.cancelEdit()
 				return m, nil
 			}
-		case "down":
-			if m.ShowAutocomplete && m.AutocompleteIdx < len(m.AutocompleteList)-1 {
-				m.AutocompleteIdx++
+			if msg.String() == "esc" && m.Focus != FocusInput {
+				m.setFocus(FocusInput)
+				return m, nil
+			}
+			if msg.String() == "esc" && m.SelectedCard != "" {
+				m.SelectedCard = ""
+				m.RenderChat()
 				return m, nil
 			}
+			return m, m.quit()
+
+		case "shift+tab":
+			m.togglePlanMode()
+			return m, nil
+
+		case "ctrl+o":
+			// Expand/collapse the selected tool card, or every card when none is selected
+			m.toggleCard()
+			return m, nil
+
+		case "ctrl+g":
+			// Round-trip the draft through $EDITOR, with pasted chips expanded
+			m.setFocus(FocusInput)
+			return m, openEditorCmd(m.expandPastes(m.Input.Value()))
+
+		case "alt+up", "alt+down":
+			m.selectCard(msg.String() == "alt+down")
+			return m, nil
+
 		case "tab":
 			if m.ShowAutocomplete && len(m.AutocompleteList) > 0 {
-				// Insert selected file
-				selected := m.AutocompleteList[m.AutocompleteIdx]
-				currentVal := m.Input.Value()
-				// Replace the @partial with @fullpath
-				words := strings.Fields(currentVal)
-				if len(words) > 0 {
-					words[len(words)-1] = "@" + selected
-					m.Input.SetValue(strings.Join(words, " ") + " ")
-				}
-				m.ShowAutocomplete = false
+				m.selectAutocomplete()
 				return m, nil
 			}
+			m.cycleFocus()
+			return m, nil
+		}
 
+		// Chat and sidebar take scroll keys instead of the input while focused
+		if m.Focus != FocusInput {
+			return m, m.updateFocusedPane(msg)
+		}
+
+		if msg.Paste {
+			m.pasteInput(string(msg.Runes))
+			return m, nil
+		}
+
+		switch msg.String() {
+		case "up":
+			if m.ShowAutocomplete {
+				if m.AutocompleteIdx > 0 {
+					m.AutocompleteIdx--
+					if m.AutocompleteIdx < m.AutocompleteOffset {
+						m.AutocompleteOffset = m.AutocompleteIdx
+					}
+				}
+				return m, nil
+			}
+			if m.recallPrompt(true) {
+				return m, nil
+			}
+		case "down":
+			if m.ShowAutocomplete {
+				if m.AutocompleteIdx < len(m.AutocompleteList)-1 {
+					m.AutocompleteIdx++
+					if m.AutocompleteIdx >= m.AutocompleteOffset+autocompleteHeight {
+						m.AutocompleteOffset = m.AutocompleteIdx - autocompleteHeight + 1
+					}
+				}
+				return m, nil
+			}
+			if m.recallPrompt(false) {
+				return m, nil
+			}
 		case "enter":
 			// If autocomplete is showing, select item
 			if m.ShowAutocomplete && len(m.AutocompleteList) > 0 {
-				selected := m.AutocompleteList[m.AutocompleteIdx]
-				currentVal := m.Input.Value()
-				words := strings.Fields(currentVal)
-				if len(words) > 0 {
-					words[len(words)-1] = "@" + selected
-					m.Input.SetValue(strings.Join(words, " ") + " ")
-				}
-				m.ShowAutocomplete = false
+				m.selectAutocomplete()
 				return m, nil
 			}
 			if !msg.Alt && m.Input.Value() != "" {
-				// 1. Parse for @tags and read files
-				userMsg := m.Input.Value()
-				finalContent := m.resolveFileTags(userMsg)
-
-				// 2. Add to History
-				m.History = append(m.History, openai.ChatCompletionMessage{
-					Role:    openai.ChatMessageRoleUser,
-					Content: finalContent,
-				})
+				userMsg := m.expandPastes(m.Input.Value())
+				m.Pastes = nil
+				if err := m.Prompts.Add(userMsg); err != nil {
+					slog.Warn("Failed to save prompt history", "error", err)
+				}
 
-				// 3. Clear Input
+				// 1. Clear Input (a slash command may refill it, e.g. /queue edit)
 				m.Input.Reset()
 
-				// 4. Handle State
+				// An edited earlier message replaces the rest of the conversation on a new branch
+				if m.EditingMessage > 0 {
+					if m.State != StateIdle {
+						m.Input.SetValue(userMsg)
+						m.Status = "Wait for the current turn to finish before re-running an edited message"
+						return m, nil
+					}
+					cmd := m.branchFrom(m.EditingMessage-1, userMsg)
+					m.RenderChat()
+					m.Viewport.GotoBottom()
+					return m, cmd
+				}
+
+				// 2. Local slash commands never reach the model
+				if strings.HasPrefix(userMsg, "/") {
+					if cmd, ok := m.handleSlashCommand(userMsg); ok {
+						m.RenderChat()
+						return m, cmd
+					}
+				}
+				m.Status = ""
+
+				// 3. Handle State: messages join the history only when they are sent
 				if m.State == StateIdle {
 					// Start AI immediately
+					m.QueueEdit = 0
+					m.beginTurn()
+					m.appendUserMessage(userMsg)
 					m.State = StateThinking
-					cmds = append(cmds, m.InvokeAI()) // Initial call logic
+					cmds = append(cmds, m.startTurn()) // Initial call logic
 				} else {
 					// Queue it
-					m.PendingQueue = append(m.PendingQueue, finalContent)
+					m.queueMessage(userMsg)
 				}
 				m.RenderChat()
 				// Don't process the enter in textarea
@@ -166,32 +243,74 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+	case EditorDoneMsg:
+		if msg.Err != nil {
+			m.Status = fmt.Sprintf("Editor failed: %v", msg.Err)
+			return m, nil
+		}
+		m.Pastes = nil
+		m.Input.SetValue(msg.Content)
+		m.updateAutocomplete()
+		return m, nil
+
+	case CheckpointMsg:
+		m.addCheckpoints(msg)
+
+	case RetryStatusMsg:
+		if msg.Event.Done {
+			m.Retry = RetryStatusMsg{}
+		} else {
+			m.Retry = msg
+		}
+		return m, WaitForStatus(m.StatusChan)
+
+	case MaxIterationsMsg:
+		// Keep the partial work and ask before spending more
+		m.History = msg.History
+		m.State = StateConfirmContinue
+		m.RenderChat()
+		m.Viewport.GotoBottom()
+		return m, nil
+
 	// AI Response (with full history update)
 	case AiResponseMsg:
+		m.ExtraIterations = 0
+		m.Retry = RetryStatusMsg{}
 		m.History = msg.History
+		m.capturePlan()
+		m.saveBranches()
 		m.RenderChat()
 		m.Viewport.GotoBottom()
-		cmds = append(cmds, func() tea.Msg { return AiCompleteMsg{} })
+		// The agent may have created or removed files during the turn
+		cmds = append(cmds, func() tea.Msg { return AiCompleteMsg{} }, RefreshFilesCmd())
+
+	case FilesRefreshedMsg:
+		m.Files = msg
+		// Files changed, so the git tab may be stale
+		if tab := m.activeTab(); tab != nil && tab.Kind == agent.WindowGit {
+			m.refreshTab(tab)
+			m.renderSidebar()
+		}
+		if m.ShowAutocomplete {
+			m.updateAutocomplete()
+		}
+		return m, nil
 
 	case AiCompleteMsg:
 		m.State = StateIdle
 		// If we have queued messages, fire the next one!
-		if len(m.PendingQueue) > 0 {
-			nextContent := m.PendingQueue[0]
-			m.PendingQueue = m.PendingQueue[1:]
-
-			m.History = append(m.History, openai.ChatCompletionMessage{
-				Role:    openai.ChatMessageRoleUser,
-				Content: nextContent,
-			})
+		if cmd := m.sendNext(); cmd != nil {
 			m.RenderChat()
-
-			m.State = StateThinking
-			cmds = append(cmds, m.InvokeAI())
+			cmds = append(cmds, cmd)
 		}
 
 	case ErrMsg:
 		slog.Error("Error received in UI", "error", msg)
+		m.ExtraIterations = 0
+		m.Retry = RetryStatusMsg{}
+		// Steering that arrived too late for the failed turn waits at the front of the queue
+		m.PendingQueue = append(m.Turn.TakeSteering(), m.PendingQueue...)
+		m.PendingTools = nil
 		m.History = append(m.History, openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleAssistant,
 			Content: fmt.Sprintf("**Error:** %v", msg),
@@ -200,33 +319,85 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.RenderChat()
 		m.Viewport.GotoBottom()
 
+	case UpdatePlanMsg:
+		m.History = msg.History
+		m.appendToolResult(msg.ToolCallID, m.applyPlanUpdate(msg.Input))
+		m.RenderChat()
+		m.Viewport.GotoBottom()
+		m.State = StateThinking
+		return m, m.resumeTurn()
+
+	case TodoWriteMsg:
+		m.Todos = msg.Todos
+		m.History = msg.History
+		m.appendToolResult(msg.ToolCallID, agent.ToolResult{Content: "Todo list updated.\n\n" + agent.FormatChecklist(m.Todos)})
+
+		// Open the todos tab the first time there is something to show
+		cmds = append(cmds, m.resumeTurn())
+		if m.tabIndex(agent.WindowTodos) == -1 && len(m.Todos) > 0 {
+			m.openTodosTab()
+			cmds = append(cmds, m.resizeCmd())
+		}
+		m.renderSidebar()
+		m.RenderChat()
+		m.Viewport.GotoBottom()
+		m.State = StateThinking
+		return m, tea.Batch(cmds...)
+
+	// --- Sub-agent Handlers ---
+
+	case DelegateTaskMsg:
+		// Show the pending delegation while the child session runs
+		m.History = msg.History
+		m.ToolLog.Start(msg.ToolCallID)
+		m.RenderChat()
+		m.Viewport.GotoBottom()
+		return m, RunSubagentCmd(m.chatCompletion, msg.Input, msg.ToolCallID)
+
+	case SubagentDoneMsg:
+		m.Subagents[msg.ToolCallID] = msg.Transcript
+		result := agent.ToolResult{Content: msg.Summary}
+		if msg.Err != nil {
+			result = agent.ErrorResult(fmt.Errorf("sub-agent failed: %w", msg.Err))
+		}
+		// Only the summary goes into the parent history
+		m.appendToolResult(msg.ToolCallID, result)
+		m.RenderChat()
+		m.Viewport.GotoBottom()
+		m.State = StateThinking
+		return m, tea.Batch(m.resumeTurn(), RefreshFilesCmd())
+
 	// --- Process Streaming Handlers ---
 
 	case RunCommandMsg:
 		// 1. Update history with what happened inside the AI loop (including the Assistant's tool call)
 		m.History = msg.History
+		m.ToolLog.Start(msg.ToolCallID)
 		m.ProcessOutput = "" // Reset output buffer
+		if m.ShowSidebar {
+			// Each command gets its own terminal tab
+			m.openProcessTab(msg.ToolCallID, msg.Command, msg.Args)
+		}
 		m.RenderChat()
 
 		// 2. Start the process AND start the subscriber
 		return m, tea.Batch(
-			RunProcessCmd(msg.Command, msg.Args, msg.ToolCallID, m.ProcessChan),
+			RunProcessCmd(m.Turn.Context(), msg.Command, msg.Args, msg.ToolCallID, m.ProcessChan),
 			WaitForProcessOutput(m.ProcessChan),
 		)
 
 	case ProcessOutputMsg:
 		// Accumulate output
-		if m.ShowSidebar {
-			// Redirect to SideViewport
-			// Currently SideViewport content is not persistent in a string buffer in Model (unlike ProcessOutput)
-			// So we need to append to what's there? Viewport doesn't support Append easily.
-			// Let's store sidebar content in m.ProcessOutput as well or a specific buffer?
-			// Actually, let's just append to m.ProcessOutput and let SideViewport render IT.
+		if i := m.tabIndex(m.ProcessTab); i != -1 && m.ShowSidebar {
+			// Redirect to the process's terminal tab
 			m.ProcessOutput += string(msg) + "\n"
+			m.Tabs[i].Output += string(msg) + "\n"
 
-			// Update SideViewport content
-			m.SideViewport.SetContent(m.ProcessOutput)
-			m.SideViewport.GotoBottom()
+			// Follow the output if the tab is on screen
+			if i == m.ActiveTab {
+				m.renderSidebar()
+				m.SideViewport.GotoBottom()
+			}
 		} else {
 			m.ProcessOutput += string(msg) + "\n"
 			m.RenderChat()
@@ -241,6 +412,13 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if msg.Err != nil {
 			result = fmt.Sprintf("Process exited with error: %v", msg.Err)
 		}
+		m.ToolLog.Record(msg.ToolCallID, processResult(result, msg.Err))
+		if i := m.tabIndex(m.ProcessTab); i != -1 {
+			m.Tabs[i].Running = false
+			m.Tabs[i].Output += "\n" + result + "\n"
+			m.renderSidebar()
+		}
+		m.ProcessTab = ""
 		// Add result as Tool Output message to history so model sees it
 		m.History = append(m.History, openai.ChatCompletionMessage{
 			Role:       openai.ChatMessageRoleTool,
@@ -270,58 +448,23 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.Viewport.GotoBottom()
 		// Trigger AI to see the result
 		m.State = StateThinking
-		return m, m.InvokeAI()
+		return m, tea.Batch(m.resumeTurn(), RefreshFilesCmd())
 	}
 
 	m.Input, tiCmd = m.Input.Update(msg)
 
 	// Check if we should show autocomplete
-	inputVal := m.Input.Value()
-	words := strings.Fields(inputVal)
-	if len(words) > 0 {
-		lastWord := words[len(words)-1]
-		if strings.HasPrefix(lastWord, "@") {
-			search := strings.TrimPrefix(lastWord, "@")
-
-			// Check if this is an exact match (file already selected)
-			isExactMatch := false
-			for _, f := range m.Files {
-				if f == search {
-					isExactMatch = true
-					break
-				}
-			}
-
-			// Don't show autocomplete if file is already fully selected
-			if isExactMatch {
-				m.ShowAutocomplete = false
-			} else {
-				m.AutocompleteList = []string{}
-				for _, f := range m.Files {
-					if search == "" || strings.Contains(f, search) {
-						m.AutocompleteList = append(m.AutocompleteList, f)
-						if len(m.AutocompleteList) >= 10 {
-							break // Limit to 10 items
-						}
-					}
-				}
-				if len(m.AutocompleteList) > 0 {
-					m.ShowAutocomplete = true
-					if m.AutocompleteIdx >= len(m.AutocompleteList) {
-						m.AutocompleteIdx = 0
-					}
-				} else {
-					m.ShowAutocomplete = false
-				}
-			}
-		} else {
-			m.ShowAutocomplete = false
-		}
-	} else {
-		m.ShowAutocomplete = false
+	wasShowing := m.ShowAutocomplete
+	m.updateAutocomplete()
+	if m.ShowAutocomplete && !wasShowing {
+		// Pick up files created since the last refresh
+		cmds = append(cmds, RefreshFilesCmd())
 	}
 
-	m.Viewport, vpCmd = m.Viewport.Update(msg)
+	// While typing, only page keys (and the mouse) scroll the chat
+	if key, ok := msg.(tea.KeyMsg); !ok || key.Type == tea.KeyPgUp || key.Type == tea.KeyPgDown {
+		m.Viewport, vpCmd = m.Viewport.Update(msg)
+	}
 
 	// Always update spinner if thinking
 	if m.State == StateThinking {
@@ -332,10 +475,61 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// autocompleteHeight is the number of autocomplete rows visible at once
+const autocompleteHeight = 10
+
+// updateAutocomplete recomputes the fuzzy matches for the @word being typed
+func (m *Model) updateAutocomplete() {
+	words := strings.Fields(m.Input.Value())
+	if len(words) == 0 || !strings.HasPrefix(words[len(words)-1], "@") {
+		m.ShowAutocomplete = false
+		return
+	}
+	search := strings.TrimPrefix(words[len(words)-1], "@")
+
+	// Don't show autocomplete if file is already fully selected
+	for _, f := range m.Files {
+		if f == search {
+			m.ShowAutocomplete = false
+			return
+		}
+	}
+
+	m.AutocompleteList = fuzzyFilter(search, m.Files)
+	if len(m.AutocompleteList) == 0 {
+		m.ShowAutocomplete = false
+		return
+	}
+
+	m.ShowAutocomplete = true
+	if m.AutocompleteIdx >= len(m.AutocompleteList) {
+		m.AutocompleteIdx = 0
+		m.AutocompleteOffset = 0
+	}
+	if m.AutocompleteOffset > m.AutocompleteIdx {
+		m.AutocompleteOffset = m.AutocompleteIdx
+	}
+}
+
+// selectAutocomplete replaces the @partial being typed with the highlighted file
+func (m *Model) selectAutocomplete() {
+	selected := m.AutocompleteList[m.AutocompleteIdx].Path
+	words := strings.Fields(m.Input.Value())
+	if len(words) > 0 {
+		words[len(words)-1] = "@" + selected
+		m.Input.SetValue(strings.Join(words, " ") + " ")
+	}
+	m.ShowAutocomplete = false
+	m.AutocompleteIdx = 0
+	m.AutocompleteOffset = 0
+}
+
 func (m Model) SaveSession() {
 	if len(m.History) == 0 {
 		return
 	}
+	// Every branch goes to .trace/sessions; the transcript below is the current one
+	m.saveBranches()
 
 	// Regex to strip hints about file references
 	reHint := regexp.MustCompile(`\n\n\[User has referenced these files:.*?\]`)
@@ -382,6 +576,14 @@ func (m Model) SaveSession() {
 
 		fmt.Fprintf(f, "## %s\n\n%s\n\n---\n\n", role, content)
 	}
+
+	// Keep the task state with the transcript
+	if len(m.Plan) > 0 {
+		fmt.Fprintf(f, "## Plan\n\n%s\n", agent.FormatChecklist(m.Plan))
+	}
+	if len(m.Todos) > 0 {
+		fmt.Fprintf(f, "## Todos\n\n%s\n", agent.FormatChecklist(m.Todos))
+	}
 }
 
 // Detect @filename and append hints for the model to read them
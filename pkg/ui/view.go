@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/bethel-nz/trace/pkg/agent"
@@ -20,21 +21,40 @@ func (m Model) View() string {
 		return "Initializing..."
 	}
 
+	// The focused pane gets the highlighted border
+	chatStyle, sideStyle, inputStyle := blurredStyle, blurredStyle, blurredStyle
+	switch m.Focus {
+	case FocusChat:
+		chatStyle = focusedStyle
+	case FocusSidebar:
+		sideStyle = focusedStyle
+	default:
+		inputStyle = focusedStyle
+	}
+
 	// Single column layout
-	chatBox := blurredStyle.Width(m.Width - 2).Height(m.Viewport.Height).Render(m.Viewport.View())
-	inputBox := focusedStyle.Width(m.Width - 2).Render(m.Input.View())
+	chatBox := chatStyle.Width(m.Width - 2).Height(m.Viewport.Height).Render(m.Viewport.View())
+	inputBox := inputStyle.Width(m.Width - 2).Render(m.Input.View())
 
 	// Autocomplete overlay
 	if m.ShowAutocomplete && len(m.AutocompleteList) > 0 {
 		var autocompleteContent strings.Builder
-		autocompleteContent.WriteString("Files:\n")
-		for i, file := range m.AutocompleteList {
+		fmt.Fprintf(&autocompleteContent, "Files (%d/%d):\n", m.AutocompleteIdx+1, len(m.AutocompleteList))
+		end := m.AutocompleteOffset + autocompleteHeight
+		if end > len(m.AutocompleteList) {
+			end = len(m.AutocompleteList)
+		}
+		for i := m.AutocompleteOffset; i < end; i++ {
+			match := m.AutocompleteList[i]
 			if i == m.AutocompleteIdx {
-				autocompleteContent.WriteString(fileSelected.Render("> "+file) + "\n")
+				autocompleteContent.WriteString(fileSelected.Render("> ") + highlightMatch(match, fileSelected) + "\n")
 			} else {
-				autocompleteContent.WriteString(fileNormal.Render("  "+file) + "\n")
+				autocompleteContent.WriteString(fileNormal.Render("  ") + highlightMatch(match, fileNormal) + "\n")
 			}
 		}
+		if end < len(m.AutocompleteList) {
+			autocompleteContent.WriteString(mutedStyle.Render(fmt.Sprintf("… %d more", len(m.AutocompleteList)-end)) + "\n")
+		}
 		autocompleteContent.WriteString("\n↑↓: Navigate | Tab/Enter: Select | Esc: Cancel")
 
 		autocompleteBox := focusedStyle.
@@ -49,9 +69,21 @@ func (m Model) View() string {
 	// Status Bar
 	statusContent := fmt.Sprintf(" Model: %s │ Tools: %d │ Messages: %d ",
 		os.Getenv("PROVIDER_MODEL"),
-		len(agent.GetAllToolDefinitions()),
+		len(m.availableTools()),
 		len(m.History),
 	)
+	if m.PlanMode {
+		statusContent += "│ PLAN MODE "
+	}
+	if m.Worktree != nil {
+		statusContent += "│ WORKTREE " + m.Worktree.Branch + " "
+	}
+	switch m.Focus {
+	case FocusChat:
+		statusContent += "│ CHAT: ↑↓ scroll, alt+↑↓ select, enter expand card or edit message, tab next, esc back "
+	case FocusSidebar:
+		statusContent += "│ SIDEBAR: ↑↓ scroll, ←→ tabs, x close tab, n next match, esc back "
+	}
 	statusStyle := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("241")).
 		Background(lipgloss.Color("235")).
@@ -62,8 +94,18 @@ func (m Model) View() string {
 
 	// Determine middle content (Spinner or nothing)
 	var midContent string
-	if m.State == StateThinking {
+	if m.WorktreeChanges != "" {
+		midContent = "\n" + mutedStyle.Render(m.WorktreeChanges) + "\n" + checkActive.Render(
+			fmt.Sprintf("Session changes on %s: [m]erge, [p]atch, [d]iscard or [k]eep the worktree? (esc to go back)", m.Worktree.Branch))
+	} else if m.State == StateThinking && m.Retry.Event.MaxAttempts > 0 {
+		midContent = "\n" + checkActive.Render(fmt.Sprintf(" %s %s", m.Spinner.View(), m.retryStatus()))
+	} else if m.State == StateThinking {
 		midContent = fmt.Sprintf("\n %s Thinking...", m.Spinner.View())
+	} else if m.State == StateConfirmContinue {
+		midContent = "\n" + checkActive.Render(fmt.Sprintf("Reached %d steps this turn. Continue for another %d? (y/n)",
+			turnSteps(m.History, m.TurnStart), m.Config.Agent.ContinueIterations))
+	} else if m.Status != "" {
+		midContent = "\n" + mutedStyle.Render(m.Status)
 	}
 
 	var mainView string
@@ -71,9 +113,10 @@ func (m Model) View() string {
 		// Re-render chatBox with constrained width
 		// m.Viewport.Width was already updated in Update() to be chatWidth
 		// So we just need to respect it here instead of using m.Width
-		chatBox = blurredStyle.Width(m.Viewport.Width).Height(m.Viewport.Height).Render(m.Viewport.View())
+		chatBox = chatStyle.Width(m.Viewport.Width).Height(m.Viewport.Height).Render(m.Viewport.View())
 
-		sideBox := blurredStyle.Width(m.SideViewport.Width).Height(m.SideViewport.Height).Render(m.SideViewport.View())
+		sideContent := lipgloss.JoinVertical(lipgloss.Left, m.renderTabBar(), m.SideViewport.View())
+		sideBox := sideStyle.Width(m.SideViewport.Width).Height(m.SideViewport.Height + 1).Render(sideContent)
 		mainView = lipgloss.JoinHorizontal(lipgloss.Top, chatBox, sideBox)
 	} else {
 		mainView = chatBox
@@ -84,6 +127,27 @@ func (m Model) View() string {
 
 // --- Helpers ---
 
+// highlightMatch renders a file path with the fuzzy-matched runes emphasised
+func highlightMatch(match FileMatch, base lipgloss.Style) string {
+	if len(match.Positions) == 0 {
+		return base.Render(match.Path)
+	}
+	matched := make(map[int]bool, len(match.Positions))
+	for _, p := range match.Positions {
+		matched[p] = true
+	}
+
+	var b strings.Builder
+	for i, r := range []rune(match.Path) {
+		if matched[i] {
+			b.WriteString(fileMatched.Render(string(r)))
+		} else {
+			b.WriteString(base.Render(string(r)))
+		}
+	}
+	return b.String()
+}
+
 // Render the Markdown Chat
 func (m *Model) RenderChat() {
 	buf := new(strings.Builder)
@@ -102,14 +166,16 @@ func (m *Model) RenderChat() {
 	)
 
 	// Helper to render and append a message block
-	renderBlock := func(role, content string) {
+	renderBlock := func(role, content string, selected bool) {
 		if visibleCount > 0 {
 			fmt.Fprint(buf, "\n\n___\n\n")
 		}
 
 		// Render title with proper style
 		var title string
-		if role == "user" {
+		if role == "user" && selected {
+			title = userStyle.Render("You") + toolMeta.Render(" · ctrl+o to edit and re-run from here")
+		} else if role == "user" {
 			title = userStyle.Render("You")
 		} else {
 			title = traceStyle.Render("Trace")
@@ -138,8 +204,18 @@ func (m *Model) RenderChat() {
 		visibleCount++
 	}
 
+	// Tool results by call ID, so each card can show its outcome
+	results := make(map[string]*openai.ChatCompletionMessage)
+	for i := range m.History {
+		if m.History[i].Role == openai.ChatMessageRoleTool {
+			results[m.History[i].ToolCallID] = &m.History[i]
+		}
+	}
+	m.cardIDs = nil
+	m.cardLines = nil
+
 	// Render history
-	for _, msg := range m.History {
+	for i, msg := range m.History {
 		// Skip the internal auto-trigger message
 		if msg.Role == openai.ChatMessageRoleUser && msg.Content == "Hello! Please introduce yourself and your tools briefly." {
 			continue
@@ -148,47 +224,62 @@ func (m *Model) RenderChat() {
 		if msg.Role == "system" {
 			continue
 		}
-		// Skip tool messages (internal tool results)
+		// Skip tool messages; their results are shown in the tool cards
 		if msg.Role == openai.ChatMessageRoleTool {
 			continue
 		}
-		// Skip assistant messages that are just tool calls (no content to show)
-		if msg.Role == openai.ChatMessageRoleAssistant && msg.Content == "" && len(msg.ToolCalls) > 0 {
-			continue
-		}
 
 		switch msg.Role {
 		case openai.ChatMessageRoleUser:
-			renderBlock("user", msg.Content)
+			// User messages can be selected like cards, to edit them
+			id := messageSelectPrefix + strconv.Itoa(i)
+			m.cardIDs = append(m.cardIDs, id)
+			m.cardLines = append(m.cardLines, strings.Count(buf.String(), "\n"))
+			renderBlock("user", msg.Content, id == m.SelectedCard)
 
 		case openai.ChatMessageRoleAssistant:
-			// Check if this message has tool calls
-			if len(msg.ToolCalls) > 0 {
-				for _, tc := range msg.ToolCalls {
-					if visibleCount > 0 {
-						fmt.Fprint(buf, "\n\n___\n\n")
-					}
-					fmt.Fprintf(buf, "**Calling tool:** `%s`\n", tc.Function.Name)
-					visibleCount++
+			if msg.Content != "" {
+				renderBlock("assistant", msg.Content, false)
+			}
+			// One card per tool call, grouped under the message that made them
+			for i, tc := range msg.ToolCalls {
+				if i == 0 {
+					fmt.Fprint(buf, "\n\n")
+				} else {
+					fmt.Fprint(buf, "\n")
 				}
+				m.cardIDs = append(m.cardIDs, tc.ID)
+				m.cardLines = append(m.cardLines, strings.Count(buf.String(), "\n"))
+				fmt.Fprint(buf, m.renderToolCard(tc, results[tc.ID]))
 			}
-			if msg.Content != "" {
-				renderBlock("assistant", msg.Content)
+			if len(msg.ToolCalls) > 0 {
+				visibleCount++
 			}
 		}
 	}
 
-	// Render Queue (Grayed out)
-	for i, q := range m.PendingQueue {
-		cleanQ := reContext.ReplaceAllString(q, "")
-		cleanQ = strings.TrimSpace(cleanQ)
-		if len(cleanQ) > 50 {
-			cleanQ = cleanQ[:47] + "..."
+	// Render the approved plan as a checklist
+	if len(m.Plan) > 0 {
+		if visibleCount > 0 {
+			fmt.Fprint(buf, "\n\n___\n\n")
+		}
+		fmt.Fprint(buf, renderChecklist("Plan", m.Plan))
+		visibleCount++
+	}
+
+	// Render steering waiting for the next model call, then the queue (Grayed out)
+	for _, q := range m.Turn.Steering() {
+		if visibleCount > 0 {
+			fmt.Fprint(buf, "\n\n___\n\n")
 		}
+		fmt.Fprintf(buf, "_(Steering): %s_\n", truncate(reContext.ReplaceAllString(q, ""), 50))
+		visibleCount++
+	}
+	for i, q := range m.PendingQueue {
 		if visibleCount > 0 || i > 0 {
 			fmt.Fprint(buf, "\n\n___\n\n")
 		}
-		fmt.Fprintf(buf, "_(Queued #%d): %s_\n", i+1, cleanQ)
+		fmt.Fprintf(buf, "_(Queued #%d): %s_\n", i+1, truncate(reContext.ReplaceAllString(q, ""), 50))
 		visibleCount++
 	}
 
@@ -202,3 +293,37 @@ func (m *Model) RenderChat() {
 
 	m.Viewport.SetContent(buf.String())
 }
+
+// renderSidebar fills the sidebar with the content of the active tab
+func (m *Model) renderSidebar() {
+	tab := m.activeTab()
+	if tab == nil {
+		m.SideViewport.SetContent("")
+		return
+	}
+	switch tab.Kind {
+	case agent.WindowFile, agent.WindowDiff:
+		m.SideViewport.SetContent(renderPane(&tab.Pane))
+	case agent.WindowTodos:
+		if len(m.Todos) == 0 {
+			m.SideViewport.SetContent(mutedStyle.Render("No todos yet."))
+		} else {
+			m.SideViewport.SetContent(renderChecklist("Todos", m.Todos))
+		}
+	default:
+		m.SideViewport.SetContent(tab.Output)
+	}
+}
+
+// truncate shortens s to a single line of at most n runes
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) > n && n < 4 {
+		return string(runes[:max(n, 0)]) // No room for an ellipsis
+	}
+	if len(runes) > n {
+		return string(runes[:n-3]) + "..."
+	}
+	return s
+}
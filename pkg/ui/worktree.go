@@ -0,0 +1,71 @@
+package ui
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --- Worktree Sessions ---
+
+// quit saves the session and exits. A session in a worktree first asks what to do
+// with its changes, or discards the worktree straight away when nothing changed.
+func (m *Model) quit() tea.Cmd {
+	if m.Worktree == nil {
+		m.SaveSession()
+		m.closeSnapshots()
+		return tea.Quit
+	}
+	// Stop the agent so the changes shown are the ones merged
+	m.Turn.Cancel()
+	changes, err := m.Worktree.Changes()
+	if err != nil {
+		m.Status = fmt.Sprintf("Worktree: %v", err)
+		return nil
+	}
+	if changes == "" {
+		return m.finishWorktree("d")
+	}
+	m.WorktreeChanges = changes
+	return nil
+}
+
+// finishWorktree applies the choice made on exit: merge, patch, discard or keep.
+// Any other key goes back to the session.
+func (m *Model) finishWorktree(choice string) tea.Cmd {
+	w := m.Worktree
+	var message string
+	var err error
+	switch choice {
+	case "m":
+		message, err = w.Merge()
+	case "p":
+		message, err = w.Patch()
+	case "d":
+		if err = w.Discard(); err == nil {
+			message = fmt.Sprintf("Discarded the worktree and branch %s.", w.Branch)
+		}
+	case "k":
+		message = fmt.Sprintf("Kept the worktree at %s on branch %s.", w.Path, w.Branch)
+	default:
+		m.WorktreeChanges = ""
+		return nil
+	}
+	if err != nil {
+		slog.Error("Finishing worktree failed", "choice", choice, "error", err)
+		m.WorktreeChanges = ""
+		m.Status = fmt.Sprintf("Worktree: %v", err)
+		return nil
+	}
+
+	// The transcript belongs in the user's checkout, not the worktree
+	if err := os.Chdir(w.Origin); err != nil {
+		slog.Warn("Failed to leave the worktree", "error", err)
+	}
+	m.ExitMessage = message
+	m.SaveSession()
+	m.closeSnapshots()
+	return tea.Quit
+}
@@ -0,0 +1,57 @@
+package ui
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bethel-nz/trace/pkg/config"
+	"github.com/bethel-nz/trace/pkg/worktree"
+)
+
+func TestWorktreeExit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{{"init", "-q"}, {"add", "."}, {"-c", "user.name=Test", "-c", "user.email=test@localhost", "commit", "-q", "-m", "init"}} {
+		if args[0] == "add" {
+			os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one"), 0644)
+		}
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s", args, out)
+		}
+	}
+	w, err := worktree.Create(dir)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	t.Chdir(w.Dir())
+
+	m := InitialModel(nil, config.Default(), nil, "")
+	m.Worktree = w
+	os.WriteFile(filepath.Join(w.Dir(), "a.txt"), []byte("two"), 0644)
+
+	// Changes are shown before quitting, and esc goes back to the session
+	if cmd := m.quit(); cmd != nil || !strings.Contains(m.WorktreeChanges, "a.txt") {
+		t.Fatalf("Expected the exit prompt with a diffstat, got %q", m.WorktreeChanges)
+	}
+	if cmd := m.finishWorktree("esc"); cmd != nil || m.WorktreeChanges != "" {
+		t.Fatal("Expected esc to return to the session")
+	}
+
+	m.quit()
+	if cmd := m.finishWorktree("d"); cmd == nil || !strings.Contains(m.ExitMessage, "Discarded") {
+		t.Fatalf("Expected discard to quit, got %q", m.ExitMessage)
+	}
+	if cwd, _ := os.Getwd(); cwd != w.Origin {
+		t.Errorf("Expected to leave the worktree, cwd is %s", cwd)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(got) != "one" {
+		t.Errorf("Expected the checkout untouched, got %q", got)
+	}
+}
@@ -0,0 +1,170 @@
+// Package worktree runs a session in its own git worktree and branch, so the agent's
+// edits and commands never touch the user's checkout until the session is merged.
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bethel-nz/trace/pkg/config"
+)
+
+// Session branches are named trace/<start time>
+const branchPrefix = "trace/"
+
+// Worktrees are created in this directory inside the repository's git directory
+const worktreeDir = "trace-worktrees"
+
+// Worktree is the isolated checkout of one session
+type Worktree struct {
+	Origin string // Directory Trace was started in, inside the user's checkout
+	Root   string // Top level of the user's checkout
+	Path   string // The worktree
+	Branch string // Branch checked out in the worktree
+	Base   string // Commit the branch starts from
+
+	env []string // Commit identity for git commands
+}
+
+// Create adds a worktree on a new branch from HEAD of the repository containing dir.
+// Uncommitted changes in the user's checkout are not carried over.
+func Create(dir string) (*Worktree, error) {
+	origin, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	// git reports the top level with symlinks resolved, so Dir can relate the two
+	if resolved, err := filepath.EvalSymlinks(origin); err == nil {
+		origin = resolved
+	}
+	w := &Worktree{Origin: origin}
+	if w.Root, err = w.git(origin, "rev-parse", "--show-toplevel"); err != nil {
+		return nil, fmt.Errorf("--worktree needs a git repository: %w", err)
+	}
+	if w.Base, err = w.git(w.Root, "rev-parse", "--verify", "HEAD"); err != nil {
+		return nil, fmt.Errorf("--worktree needs at least one commit: %w", err)
+	}
+	// Session commits fall back to a Trace identity when the user has none configured
+	name, email := w.config("user.name", "Trace"), w.config("user.email", "trace@localhost")
+	w.env = []string{"GIT_AUTHOR_NAME=" + name, "GIT_AUTHOR_EMAIL=" + email, "GIT_COMMITTER_NAME=" + name, "GIT_COMMITTER_EMAIL=" + email}
+
+	// The worktree lives in the git directory, outside the user's working tree, so it never
+	// shows up in their git status or gets staged as an embedded repository
+	common, err := w.git(w.Root, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(w.Root, common)
+	}
+
+	stamp := time.Now().Format("20060102-150405")
+	w.Branch = branchPrefix + stamp
+	w.Path = filepath.Join(common, worktreeDir, stamp)
+	if _, err := w.git(w.Root, "worktree", "add", "-q", "-b", w.Branch, w.Path, w.Base); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Dir is the directory inside the worktree matching the one Trace was started in
+func (w *Worktree) Dir() string {
+	rel, err := filepath.Rel(w.Root, w.Origin)
+	if err != nil {
+		return w.Path
+	}
+	return filepath.Join(w.Path, rel)
+}
+
+// Changes commits everything done in the worktree and returns a diffstat against the base,
+// empty when nothing changed
+func (w *Worktree) Changes() (string, error) {
+	if err := w.commit(); err != nil {
+		return "", err
+	}
+	return w.git(w.Path, "diff", "--stat", w.Base, "HEAD")
+}
+
+// Merge merges the session branch into the branch checked out in the user's checkout,
+// then removes the worktree
+func (w *Worktree) Merge() (string, error) {
+	if err := w.commit(); err != nil {
+		return "", err
+	}
+	if _, err := w.git(w.Root, "merge", "--no-edit", w.Branch); err != nil {
+		return "", fmt.Errorf("%w\nThe worktree is kept at %s on branch %s", err, w.Path, w.Branch)
+	}
+	if err := w.Discard(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Merged %s into your checkout.", w.Branch), nil
+}
+
+// Patch writes the session's changes to .trace/patches as a patch for git apply,
+// then removes the worktree
+func (w *Worktree) Patch() (string, error) {
+	if err := w.commit(); err != nil {
+		return "", err
+	}
+	diff, err := w.git(w.Path, "diff", "--binary", w.Base, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(w.Root, config.ProjectDir, "patches", strings.TrimPrefix(w.Branch, branchPrefix)+".patch")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(diff+"\n"), 0644); err != nil {
+		return "", err
+	}
+	if err := w.Discard(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Saved the changes to %s (apply with git apply).", path), nil
+}
+
+// Discard removes the worktree and deletes its branch
+func (w *Worktree) Discard() error {
+	if _, err := w.git(w.Root, "worktree", "remove", "--force", w.Path); err != nil {
+		return err
+	}
+	_, err := w.git(w.Root, "branch", "-D", w.Branch)
+	return err
+}
+
+// commit records all changes in the worktree on the session branch.
+// Trace's own state in the worktree, such as the trash, is left out.
+func (w *Worktree) commit() error {
+	if _, err := w.git(w.Path, "add", "-A", "--", ".", ":(exclude)"+config.ProjectDir); err != nil {
+		return err
+	}
+	if staged, err := w.git(w.Path, "diff", "--cached", "--name-only"); err != nil || staged == "" {
+		return err
+	}
+	_, err := w.git(w.Path, "commit", "-q", "-m", "Trace session "+strings.TrimPrefix(w.Branch, branchPrefix))
+	return err
+}
+
+// git runs a git command in dir
+func (w *Worktree) git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), w.env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// config reads a git config value of the user's checkout, or returns fallback when it is unset
+func (w *Worktree) config(key, fallback string) string {
+	if value, err := w.git(w.Root, "config", key); err == nil && value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,118 @@
+package worktree
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testIdentity = []string{
+	"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@localhost",
+	"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@localhost",
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), testIdentity...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %s", args, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// newRepo creates a repository with one commit and starts a session worktree from its sub directory
+func newRepo(t *testing.T) (string, *Worktree) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	git(t, dir, "init", "-q")
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("one\n"), 0644)
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "init")
+
+	w, err := Create(filepath.Join(dir, "sub"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if w.Dir() != filepath.Join(w.Path, "sub") {
+		t.Fatalf("Expected the worktree directory matching sub, got %s", w.Dir())
+	}
+	// The user's checkout shows nothing new
+	if status := git(t, dir, "status", "--porcelain"); status != "" {
+		t.Fatalf("Expected the checkout's git status clean, got %q", status)
+	}
+	return dir, w
+}
+
+func TestWorktreeMerge(t *testing.T) {
+	dir, w := newRepo(t)
+	// Trace's own state in the worktree is not a change
+	os.MkdirAll(filepath.Join(w.Path, ".trace", "trash"), 0755)
+	os.WriteFile(filepath.Join(w.Path, ".trace", "trash", "old.txt"), []byte("x"), 0644)
+	if changes, err := w.Changes(); err != nil || changes != "" {
+		t.Fatalf("Expected no changes yet, got %q (%v)", changes, err)
+	}
+
+	os.WriteFile(filepath.Join(w.Dir(), "a.txt"), []byte("two\n"), 0644)
+	os.WriteFile(filepath.Join(w.Dir(), "b.txt"), []byte("new\n"), 0644)
+	if got, _ := os.ReadFile(filepath.Join(dir, "sub", "a.txt")); string(got) != "one\n" {
+		t.Fatalf("Expected the user's checkout untouched, got %q", got)
+	}
+
+	changes, err := w.Changes()
+	if err != nil || !strings.Contains(changes, "a.txt") || !strings.Contains(changes, "b.txt") {
+		t.Fatalf("Expected a diffstat of both files, got %q (%v)", changes, err)
+	}
+	if _, err := w.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "sub", "b.txt")); string(got) != "new\n" {
+		t.Errorf("Expected the changes merged, got %q", got)
+	}
+	if _, err := os.Stat(w.Path); !os.IsNotExist(err) {
+		t.Errorf("Expected the worktree removed")
+	}
+	if branches := git(t, dir, "branch", "--list", w.Branch); branches != "" {
+		t.Errorf("Expected the session branch deleted, got %q", branches)
+	}
+}
+
+func TestWorktreePatch(t *testing.T) {
+	dir, w := newRepo(t)
+	os.WriteFile(filepath.Join(w.Dir(), "a.txt"), []byte("two\n"), 0644)
+
+	if _, err := w.Patch(); err != nil {
+		t.Fatalf("Patch failed: %v", err)
+	}
+	patches, _ := filepath.Glob(filepath.Join(dir, ".trace", "patches", "*.patch"))
+	if len(patches) != 1 {
+		t.Fatalf("Expected one patch, got %v", patches)
+	}
+	git(t, dir, "apply", patches[0])
+	if got, _ := os.ReadFile(filepath.Join(dir, "sub", "a.txt")); string(got) != "two\n" {
+		t.Errorf("Expected the patch to apply, got %q", got)
+	}
+}
+
+func TestWorktreeDiscard(t *testing.T) {
+	dir, w := newRepo(t)
+	os.WriteFile(filepath.Join(w.Dir(), "a.txt"), []byte("two\n"), 0644)
+
+	if err := w.Discard(); err != nil {
+		t.Fatalf("Discard failed: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "sub", "a.txt")); string(got) != "one\n" {
+		t.Errorf("Expected the user's checkout untouched, got %q", got)
+	}
+	if list := git(t, dir, "worktree", "list"); strings.Contains(list, w.Path) {
+		t.Errorf("Expected the worktree removed, got %s", list)
+	}
+}